@@ -0,0 +1,732 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/diff"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/prompt"
+	"github.com/pt/ccd/internal/vcs"
+)
+
+var (
+	flagCurrent     bool
+	flagPruneDryRun bool
+)
+
+func newBackupCmd(configPath string) *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Inspect and manage backup snapshots",
+		Long: fmt.Sprintf(`Inspect the contents of backup snapshots without restoring them,
+and apply the retention policy from the backup config.
+
+Config: %s`, configPath),
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Take a manual snapshot of the target",
+		Long: `Take a snapshot of the mapped target paths and backup.extra_paths now,
+independent of a deploy. Labeled snapshots are never pruned.`,
+		Args: cobra.NoArgs,
+		RunE: runBackupCreate,
+	}
+	createCmd.Flags().StringVar(&flagLabel, "label", "", "Label the snapshot (protects it from pruning)")
+	backupCmd.AddCommand(createCmd)
+
+	showCmd := &cobra.Command{
+		Use:   "show <snapshot>",
+		Short: "Show the files stored in a snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runBackupShow,
+	}
+	backupCmd.AddCommand(showCmd)
+
+	catCmd := &cobra.Command{
+		Use:   "cat <snapshot> <path>",
+		Short: "Print a single file from a snapshot",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runBackupCat,
+	}
+	backupCmd.AddCommand(catCmd)
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify [snapshot]",
+		Short: "Check that a snapshot is complete and undamaged",
+		Long: `Read every file in a snapshot (the newest by default), checking its
+checksum and that it matches the manifest. Encrypted snapshots are
+decrypted and authenticated, which requires the key.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runBackupVerify,
+	}
+	backupCmd.AddCommand(verifyCmd)
+
+	extractCmd := &cobra.Command{
+		Use:   "extract <snapshot> <dir>",
+		Short: "Write a snapshot's files into a directory for inspection",
+		Long: `Write the files of a snapshot into any directory, leaving the target
+alone. Files already in the directory at the same paths are replaced;
+nothing else is deleted. Use --path to extract only part of the snapshot.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runBackupExtract,
+	}
+	extractCmd.Flags().StringArrayVar(&flagPaths, "path", nil, "Extract only entries matching this target-relative path or glob (repeatable)")
+	backupCmd.AddCommand(extractCmd)
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <snapshot> [snapshot|--current]",
+		Short: "Compare a snapshot with another snapshot or the live target",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runBackupDiff,
+	}
+	diffCmd.Flags().BoolVar(&flagCurrent, "current", false, "Compare against the current target directory")
+	backupCmd.AddCommand(diffCmd)
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove snapshots not kept by the retention policy",
+		Args:  cobra.NoArgs,
+		RunE:  runBackupPrune,
+	}
+	pruneCmd.Flags().BoolVar(&flagPruneDryRun, "dry-run", false, "Explain what would be kept or removed without deleting")
+	backupCmd.AddCommand(pruneCmd)
+
+	backupCmd.PersistentFlags().StringVar(&flagStore, "store", "", "Use this configured backup store instead of the default")
+
+	return backupCmd
+}
+
+// loadConfig loads the config from every layer, with the flag overrides
+// on top, and returns it with the effective target directory.
+func loadConfig() (*config.Config, string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+
+	cfg, err := config.Load(execPath, configOverrides()...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return cfg, cfg.Target, nil
+}
+
+// configOverrides returns the config keys set by command line flags, the
+// top config layer.
+func configOverrides() []config.Override {
+	var overrides []config.Override
+	if flagTarget != "" {
+		overrides = append(overrides, config.Override{Key: "target", Value: flagTarget, Flag: "--target"})
+	}
+	return overrides
+}
+
+// openStore returns the snapshots of targetDir in the named backup store,
+// or in the configured default store when name is empty.
+func openStore(cfg config.BackupConfig, name, targetDir string) (backup.Store, error) {
+	store, err := backup.StoreFromConfig(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	return backup.TargetStore(store, targetDir), nil
+}
+
+func openSnapshot(store backup.Store, keys *backup.Keys, identifier string) (*backup.Snapshot, *backup.Archive, error) {
+	snapshot, err := backup.FindSnapshot(store, identifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archive, err := snapshot.Open(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return snapshot, archive, nil
+}
+
+func runBackupCreate(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+		output.PrintError(fmt.Sprintf("Target directory does not exist: %s", targetDir))
+		return err
+	}
+
+	var sourceDir string
+	if workDir, err := os.Getwd(); err == nil {
+		sourceDir = filepath.Join(workDir, cfg.Source)
+	}
+
+	metadata := snapshotMetadata(backup.ReasonManual, sourceDir)
+	metadata.Label = flagLabel
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	output.PrintInfo("Creating backup snapshot...")
+	snapshot, err := backup.CreateSnapshot(backup.SnapshotOptions{
+		TargetDir:   targetDir,
+		Store:       store,
+		Mappings:    cfg.Mappings,
+		ExtraPaths:  cfg.Backup.ExtraPaths,
+		Metadata:    metadata,
+		Encryption:  snapshotEncryption(cfg.Backup, snapshotKeys(cfg.Backup)),
+		Compression: snapshotCompression(cfg.Backup),
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to create backup: %v", err))
+		return err
+	}
+	fmt.Fprintf(output.Stdout, "  Backup created: %s (%s)\n", snapshot.Name, backup.FormatSize(snapshot.Size))
+	output.Emit(output.EventBackup, snapshotInfo(snapshot, store))
+
+	reportPrune(store, cfg.Backup)
+
+	return nil
+}
+
+func runBackupShow(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	snapshot, archive, err := openSnapshot(store, snapshotKeys(cfg.Backup), args[0])
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	defer archive.Close()
+
+	root := snapshot.Name
+	fmt.Fprintf(output.Stdout, "Snapshot: %s\n", output.Colorize(output.Cyan, snapshot.Name))
+	fmt.Fprintf(output.Stdout, "Created: %s (%s)\n", snapshot.Timestamp.Format("2006-01-02 15:04:05"), formatAge(snapshot.Timestamp))
+	if archive.Manifest != nil {
+		root = archive.Manifest.TargetDir
+		fmt.Fprintf(output.Stdout, "Target: %s\n", output.Colorize(output.Blue, archive.Manifest.TargetDir))
+	}
+	fmt.Fprintln(output.Stdout)
+
+	var files []backup.FileEntry
+	if archive.Manifest != nil {
+		files = archive.Manifest.Files
+	} else {
+		for _, e := range archive.Files() {
+			files = append(files, e)
+		}
+	}
+
+	var totalSize int64
+	entries := make([]output.FileChange, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, output.FileChange{Path: f.Path, Size: f.Size})
+		totalSize += f.Size
+	}
+
+	tree := output.BuildTree(entries, root)
+	output.PrintTreeHeader(root)
+	fmt.Fprint(output.Stdout, output.RenderTree(tree, "", true))
+
+	fmt.Fprintf(output.Stdout, "\n%d %s, %s\n", len(entries), pluralize("file", len(entries)), backup.FormatSize(totalSize))
+	return nil
+}
+
+func runBackupCat(cmd *cobra.Command, args []string) error {
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	_, archive, err := openSnapshot(store, snapshotKeys(cfg.Backup), args[0])
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	defer archive.Close()
+
+	data, err := archive.ReadFile(args[1])
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	// The file content is the command's output in every --output mode
+	output.RawStdout()
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runBackupVerify(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	var identifier string
+	if len(args) > 0 {
+		identifier = args[0]
+	}
+
+	snapshot, archive, err := openSnapshot(store, snapshotKeys(cfg.Backup), identifier)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	defer archive.Close()
+
+	files, err := archive.Verify()
+	if err != nil {
+		err = fmt.Errorf("snapshot %s is damaged: %w", snapshot.Name, err)
+		output.PrintError(err.Error())
+		return err
+	}
+
+	detail := ""
+	if snapshot.Encrypted {
+		detail = ", decrypted and authenticated"
+	}
+	fmt.Fprintf(output.Stdout, "%s %s is intact (%d %s verified%s)\n", output.Colorize(output.Green, "✅"),
+		snapshot.Name, files, pluralize("file", files), detail)
+	return nil
+}
+
+func runBackupExtract(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	snapshot, err := backup.FindSnapshot(store, args[0])
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	return extractSnapshot(snapshot, config.ExpandPath(args[1]), snapshotKeys(cfg.Backup))
+}
+
+// extractSnapshot writes the snapshot, including extra paths, into dir,
+// limited by --path.
+func extractSnapshot(snapshot *backup.Snapshot, dir string, keys *backup.Keys) error {
+	opts := backup.RestoreOptions{Paths: flagPaths, IncludeExtra: true, Keys: keys}
+
+	n, err := backup.ExtractSnapshot(snapshot, dir, opts)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to extract snapshot: %v", err))
+		return err
+	}
+	if n == 0 && len(flagPaths) > 0 {
+		err := fmt.Errorf("no files in %s match the given paths", snapshot.Name)
+		output.PrintError(err.Error())
+		return err
+	}
+
+	output.PrintInfo(fmt.Sprintf("Extracted %d %s from %s into %s",
+		n, pluralize("file", n), snapshot.Name, dir))
+	output.Emit(output.EventRestore, output.RestoreResult{
+		Snapshot: snapshotInfo(snapshot, nil),
+		Paths:    flagPaths,
+		Into:     dir,
+		Files:    n,
+	})
+	return nil
+}
+
+func runBackupDiff(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	if len(args) == 2 && flagCurrent {
+		err := fmt.Errorf("specify either a second snapshot or --current, not both")
+		output.PrintError(err.Error())
+		return err
+	}
+	if len(args) == 1 && !flagCurrent {
+		err := fmt.Errorf("specify a second snapshot or --current")
+		output.PrintError(err.Error())
+		return err
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	keys := snapshotKeys(cfg.Backup)
+	oldSnapshot, oldArchive, err := openSnapshot(store, keys, args[0])
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	defer oldArchive.Close()
+
+	var newContents backup.Contents
+	newName := "current"
+	if flagCurrent {
+		scanned, err := backup.ScanTarget(targetDir, cfg.Mappings, cfg.Backup.ExtraPaths)
+		if err != nil {
+			output.PrintError(err.Error())
+			return err
+		}
+		newContents = scanned
+	} else {
+		newSnapshot, newArchive, err := openSnapshot(store, keys, args[1])
+		if err != nil {
+			output.PrintError(err.Error())
+			return err
+		}
+		defer newArchive.Close()
+		newContents = newArchive
+		newName = newSnapshot.Name
+	}
+
+	changes, err := backup.Compare(oldArchive, newContents)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to compare: %v", err))
+		return err
+	}
+
+	fmt.Fprintf(output.Stdout, "Comparing: %s → %s\n\n",
+		output.Colorize(output.Cyan, oldSnapshot.Name),
+		output.Colorize(output.Cyan, newName))
+
+	if len(changes) == 0 {
+		output.PrintInfo("No differences")
+		return nil
+	}
+
+	tree := output.BuildTree(changes, targetDir)
+	output.PrintTreeHeader(targetDir)
+	fmt.Fprint(output.Stdout, output.RenderTree(tree, "", true))
+
+	var summary output.Summary
+	for _, c := range changes {
+		summary.Add(c.Operation)
+	}
+	summary.Print()
+
+	for _, c := range changes {
+		var oldData, newData []byte
+		oldLabel, newLabel := "/dev/null", "/dev/null"
+
+		if c.Operation != "create" {
+			if oldData, err = oldArchive.ReadFile(c.Path); err != nil {
+				output.PrintError(fmt.Sprintf("Failed to read %s from %s: %v", c.Path, oldSnapshot.Name, err))
+				return err
+			}
+			oldLabel = oldSnapshot.Name + "/" + c.Path
+		}
+		if c.Operation != "delete" {
+			if newData, err = newContents.ReadFile(c.Path); err != nil {
+				output.PrintError(fmt.Sprintf("Failed to read %s from %s: %v", c.Path, newName, err))
+				return err
+			}
+			newLabel = newName + "/" + c.Path
+		}
+
+		fmt.Fprintln(output.Stdout)
+		fmt.Fprint(output.Stdout, diff.Colorize(diff.Files(oldLabel, newLabel, oldData, newData, diff.DefaultContext)))
+	}
+
+	return nil
+}
+
+// pruneSnapshots applies the configured retention policy to the store.
+func pruneSnapshots(store backup.Store, cfg config.BackupConfig) ([]string, error) {
+	policy, err := backup.PolicyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return backup.PruneSnapshots(store, policy)
+}
+
+// reportPrune prunes the store after a snapshot was added to it. Failing
+// to prune only warns, as the snapshot itself was taken.
+func reportPrune(store backup.Store, cfg config.BackupConfig) {
+	pruned, err := pruneSnapshots(store, cfg)
+	if err != nil {
+		output.PrintWarning(fmt.Sprintf("Failed to prune old backups: %v", err))
+		return
+	}
+	output.Emit(output.EventPrune, output.PruneResult{Removed: nonNil(pruned)})
+	if len(pruned) > 0 {
+		fmt.Fprintf(output.Stdout, "  Pruned %d old %s\n", len(pruned), pluralize("snapshot", len(pruned)))
+	}
+}
+
+func runBackupPrune(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	policy, err := backup.PolicyFromConfig(cfg.Backup)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	store, err := openStore(cfg.Backup, flagStore, targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	snapshots, err := backup.ListSnapshots(store)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to list snapshots: %v", err))
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		output.Emit(output.EventPrune, output.PruneResult{DryRun: flagPruneDryRun, Removed: []string{}})
+		output.PrintInfo("No snapshots found")
+		return nil
+	}
+
+	if backup.AppendOnly(store) {
+		kept := make([]string, len(snapshots))
+		for i, s := range snapshots {
+			kept[i] = s.Name
+		}
+		output.Emit(output.EventPrune, output.PruneResult{DryRun: flagPruneDryRun, Removed: []string{}, Kept: kept})
+		output.PrintInfo(fmt.Sprintf("Nothing to prune: %s keeps every snapshot in its git history", store))
+		return nil
+	}
+
+	decisions := backup.PlanPrune(snapshots, policy, time.Now())
+
+	var removals []backup.PruneDecision
+	result := output.PruneResult{DryRun: flagPruneDryRun, Removed: []string{}}
+	for _, d := range decisions {
+		status := output.Colorize(output.Green, "keep  ")
+		if !d.Keep {
+			status = output.Colorize(output.Red, "remove")
+			removals = append(removals, d)
+			result.Removed = append(result.Removed, d.Snapshot.Name)
+		} else {
+			result.Kept = append(result.Kept, d.Snapshot.Name)
+		}
+		fmt.Fprintf(output.Stdout, "  %s %s (%s, %s)\n", status, d.Snapshot.Name,
+			backup.FormatSize(d.Snapshot.Size), formatAge(d.Snapshot.Timestamp))
+		for _, reason := range d.Reasons {
+			fmt.Fprintf(output.Stdout, "           %s\n", reason)
+		}
+	}
+	fmt.Fprintln(output.Stdout)
+
+	if len(removals) == 0 {
+		output.Emit(output.EventPrune, result)
+		output.PrintInfo("Nothing to prune")
+		return nil
+	}
+
+	if flagPruneDryRun {
+		output.Emit(output.EventPrune, result)
+		fmt.Fprintf(output.Stdout, "%s Dry run: %d %s would be removed.\n",
+			output.Colorize(output.Yellow, "✅"), len(removals), pluralize("snapshot", len(removals)))
+		return nil
+	}
+
+	if !prompt.Confirm(fmt.Sprintf("Remove %d %s?", len(removals), pluralize("snapshot", len(removals))), flagYes) {
+		output.PrintWarning("Aborted by user")
+		return nil
+	}
+
+	for _, d := range removals {
+		if err := d.Snapshot.Delete(); err != nil {
+			output.PrintError(fmt.Sprintf("Failed to remove %s: %v", d.Snapshot.Name, err))
+			return err
+		}
+	}
+
+	output.Emit(output.EventPrune, result)
+	fmt.Fprintf(output.Stdout, "%s Pruned %d %s\n", output.Colorize(output.Green, "✅"),
+		len(removals), pluralize("snapshot", len(removals)))
+	return nil
+}
+
+// snapshotMetadata describes a snapshot taken by this ccd binary, including
+// the git state of the source directory when it is a checkout.
+func snapshotMetadata(reason, sourceDir string) backup.Metadata {
+	metadata := backup.Metadata{
+		Reason:     reason,
+		CCDVersion: version,
+	}
+
+	if sourceDir != "" {
+		if status, err := vcs.Describe(sourceDir); err == nil {
+			metadata.Source = &backup.SourceInfo{
+				Commit: status.Commit,
+				Branch: status.Branch,
+				Dirty:  status.Dirty,
+			}
+		}
+	}
+
+	return metadata
+}
+
+// formatSnapshotDetails renders snapshot metadata as a single line, e.g.
+// "deploy · sync mode · 1a2b3c4d (dirty) · +2 ~1 -0 · ccd 1.0.0 · label: stable".
+func formatSnapshotDetails(s backup.Snapshot) string {
+	m := s.Metadata
+	var parts []string
+
+	if m.Rollback != nil {
+		parts = append(parts, "pre-rollback (restoring "+m.Rollback.From+")")
+	} else if m.Reason != "" {
+		parts = append(parts, m.Reason)
+	}
+	if m.Mode != "" {
+		parts = append(parts, m.Mode+" mode")
+	}
+	if m.Source != nil {
+		commit := m.Source.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		if m.Source.Dirty {
+			commit += " (dirty)"
+		}
+		parts = append(parts, commit)
+	}
+	if m.Changes != nil {
+		parts = append(parts, fmt.Sprintf("+%d ~%d -%d", m.Changes.Created, m.Changes.Updated, m.Changes.Deleted))
+	}
+	if m.CCDVersion != "" {
+		parts = append(parts, "ccd "+m.CCDVersion)
+	}
+	if s.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+	if s.Commit != "" {
+		commit := s.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		parts = append(parts, "commit "+commit)
+	}
+	if m.Label != "" {
+		parts = append(parts, output.Colorize(output.Magenta, "label: "+m.Label))
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// passphraseEnv supplies the backup passphrase non-interactively.
+const passphraseEnv = "CCD_BACKUP_PASSPHRASE"
+
+// snapshotKeys returns the keys for reading encrypted snapshots. Without a
+// key file the passphrase comes from CCD_BACKUP_PASSPHRASE or a prompt.
+func snapshotKeys(cfg config.BackupConfig) *backup.Keys {
+	return backup.KeysFromConfig(cfg.Encryption, func(confirm bool) ([]byte, error) {
+		if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+			return []byte(passphrase), nil
+		}
+
+		passphrase, err := prompt.Password("Backup passphrase:")
+		if err != nil {
+			return nil, err
+		}
+		if confirm {
+			again, err := prompt.Password("Repeat passphrase:")
+			if err != nil {
+				return nil, err
+			}
+			if again != passphrase {
+				return nil, fmt.Errorf("passphrases do not match")
+			}
+		}
+		return []byte(passphrase), nil
+	})
+}
+
+// snapshotEncryption returns keys for new snapshots when
+// backup.encryption is enabled, and nil otherwise.
+func snapshotEncryption(cfg config.BackupConfig, keys *backup.Keys) *backup.Keys {
+	if !cfg.Encryption.Enabled {
+		return nil
+	}
+	return keys
+}
+
+// snapshotCompression returns the format and level of new snapshots.
+func snapshotCompression(cfg config.BackupConfig) backup.Compression {
+	return backup.Compression{Format: backup.Format(cfg.Format), Level: cfg.CompressionLevel}
+}
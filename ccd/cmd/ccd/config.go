@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/diff"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/prompt"
+)
+
+var flagResolved bool
+
+func newConfigCmd(configPath string) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show configuration file path",
+		Long:  "Display the full path to the configuration file being used.",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprintln(output.Stdout, configPath)
+		},
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check a config file for mistakes",
+		Long: `Check the config file in use, or the given one, the way every command
+loads it: unknown keys (such as a misspelled ignore_pattern), values of
+the wrong type and values outside the allowed set (default_mode must be
+merge or sync) are errors, reported with their file, line and column.
+Deprecated keys are reported as warnings.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runConfigValidate,
+	}
+	configCmd.AddCommand(validateCmd)
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Upgrade a config file to the current version",
+		Long: fmt.Sprintf(`Upgrade the config file in use, or the given one, to version %d:
+settings added since it was written are inserted with their defaults and
+documentation, deprecated keys are renamed (exclude becomes
+ignore_patterns) and version is set. Your values, key order and comments
+are kept, and nothing is written before you confirm the shown diff.`, config.CurrentVersion),
+		Args: cobra.MaximumNArgs(1),
+		RunE: runConfigMigrate,
+	}
+	migrateCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Show the migration without writing it")
+	configCmd.AddCommand(migrateCmd)
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the config files in use, or the effective config",
+		Long: fmt.Sprintf(`List the config files in use. Settings are merged from these layers,
+each overriding the keys it sets:
+
+  default     built into ccd
+  system      %s
+  user        ~/.config/claude-deploy/config.yaml
+  executable  config.yaml next to the ccd binary
+  repo        %s in the working directory or a parent, up to the
+              root of the git repository
+  env         %sKEY variables, e.g. CCD_TARGET or CCD_BACKUP_MAX_SNAPSHOTS;
+              lists are comma-separated
+  flag        command line flags such as --target
+
+With --resolved, print the effective config instead, each value
+annotated with the layer it came from.`, config.SystemConfigPath, config.RepoConfigName, config.EnvPrefix),
+		Args: cobra.NoArgs,
+		RunE: runConfigShow,
+	}
+	showCmd.Flags().BoolVar(&flagResolved, "resolved", false, "Print the effective config with the origin of each value")
+	configCmd.AddCommand(showCmd)
+
+	return configCmd
+}
+
+// configFiles returns the config file named by args, or the ones in use
+// from every layer.
+func configFiles(args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+	workDir, _ := os.Getwd()
+
+	var paths []string
+	for _, f := range config.Files(execPath, workDir) {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	resolved, err := config.Resolve(execPath, workDir, configOverrides())
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to load config: %v", err))
+		return err
+	}
+
+	if !flagResolved {
+		if len(resolved.Files) == 0 {
+			output.PrintInfo("No config file found, the defaults apply")
+		}
+		for _, f := range resolved.Files {
+			fmt.Fprintf(output.Stdout, "%-10s  %s\n", f.Layer, f.Path)
+		}
+		return nil
+	}
+
+	var settings []output.ConfigSetting
+	for _, s := range resolved.Settings() {
+		settings = append(settings, output.ConfigSetting{Key: s.Key, Value: s.Value, Layer: s.Origin.Layer, Source: s.Origin.Source})
+	}
+	output.Emit(output.EventConfig, settings)
+
+	annotated, err := resolved.Annotated()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	fmt.Fprint(output.Stdout, string(annotated))
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	paths := configFiles(args)
+	if len(paths) == 0 {
+		output.PrintInfo("No config file found, the defaults apply")
+		return nil
+	}
+
+	var failed []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			output.PrintError(fmt.Sprintf("Failed to read config: %v", err))
+			return err
+		}
+
+		warnings, err := config.Decode(path, data, config.Default())
+		for _, w := range warnings {
+			output.PrintWarning(w.String())
+		}
+
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, issue := range invalid.Issues {
+				output.PrintError(issue.String())
+			}
+			failed = append(failed, fmt.Sprintf("%s: %d %s", path, len(invalid.Issues), pluralize("problem", len(invalid.Issues))))
+			continue
+		}
+		if err != nil {
+			output.PrintError(err.Error())
+			return err
+		}
+
+		fmt.Fprintf(output.Stdout, "%s %s is valid\n", output.Colorize(output.Green, "✅"), path)
+	}
+
+	if len(failed) > 0 {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	paths := configFiles(args)
+	if len(paths) == 0 {
+		output.PrintInfo("No config file found, create one with: ccd init")
+		return nil
+	}
+
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Fprintln(output.Stdout)
+		}
+		if err := migrateConfig(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateConfig shows the migration of the config file at path and
+// writes it once confirmed.
+func migrateConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to read config: %v", err))
+		return err
+	}
+
+	migrated, changes, err := config.Migrate(data)
+	if err != nil {
+		err = fmt.Errorf("failed to migrate %s: %w", path, err)
+		output.PrintError(err.Error())
+		return err
+	}
+	if len(changes) == 0 {
+		output.PrintInfo("Config is already up to date")
+		fmt.Fprintf(output.Stdout, "  Path: %s\n", path)
+		return nil
+	}
+
+	fmt.Fprintf(output.Stdout, "Migrating %s to version %d:\n", path, config.CurrentVersion)
+	for _, c := range changes {
+		fmt.Fprintf(output.Stdout, "  - %s\n", c)
+	}
+	fmt.Fprintln(output.Stdout)
+	fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, "Changes:"))
+	fmt.Fprint(output.Stdout, diff.Colorize(diff.Unified(path, "migrated config", string(data), string(migrated), diff.DefaultContext)))
+
+	if flagDryRun {
+		output.PrintSuccess(true)
+		return nil
+	}
+	if !prompt.Confirm("\nWrite the migrated config?", flagYes) {
+		output.PrintWarning("Aborted by user")
+		return nil
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(path, migrated, mode); err != nil {
+		err = &config.ConfigWriteError{Path: path, Cause: err}
+		output.PrintError(err.Error())
+		return err
+	}
+
+	fmt.Fprintf(output.Stdout, "%s Migrated: %s\n", output.Colorize(output.Green, "✅"), path)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/diff"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/sync"
+)
+
+var flagShowDiff bool
+
+func newDiffCmd(configPath string) *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff [path...]",
+		Short: "Show the content changes a deploy would make",
+		Long: fmt.Sprintf(`Show a unified diff of every file a deploy would create or update,
+from the target's current content to the source's. Paths (relative to
+the target, globs allowed) limit the output, e.g. ccd diff skills/tdd.
+With --sync, files a sync deploy would delete are included.
+
+Config: %s`, configPath),
+		RunE: runDiff,
+	}
+	diffCmd.Flags().BoolVar(&flagSync, "sync", false, "Include files a sync deploy would delete")
+
+	return diffCmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	if err := backup.ValidatePathPatterns(args); err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	sourceDir := filepath.Join(workDir, cfg.Source)
+	if _, err := os.Stat(sourceDir); err != nil {
+		output.PrintError(fmt.Sprintf("Source directory does not exist: %s", sourceDir))
+		return err
+	}
+
+	result, err := sync.Sync(sync.SyncOptions{
+		SourceDir:      sourceDir,
+		TargetDir:      targetDir,
+		Mappings:       cfg.Mappings,
+		IgnorePatterns: cfg.IgnorePatterns,
+		SyncMode:       flagSync,
+		DryRun:         true,
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to calculate changes: %v", err))
+		return err
+	}
+
+	var changes []output.FileChange
+	for _, c := range result.Changes {
+		if backup.MatchPaths(args, c.Path) {
+			changes = append(changes, c)
+		}
+	}
+	emitPlan(changes)
+
+	printed, err := printChangeDiffs(changes, sourceDir, targetDir, cfg.Mappings)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	if printed == 0 {
+		output.PrintInfo("No changes detected")
+	}
+	return nil
+}
+
+// printChangeDiffs prints the diff of each file change a deploy would
+// make, ordered by path, and returns the number of files printed.
+func printChangeDiffs(changes []output.FileChange, sourceDir, targetDir string, mappings []config.Mapping) (int, error) {
+	mappingSet, err := sync.ResolveMappings(sourceDir, targetDir, mappings)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve mappings: %w", err)
+	}
+
+	sorted := make([]output.FileChange, len(changes))
+	copy(sorted, changes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	printed := 0
+	for _, c := range sorted {
+		if c.IsDir {
+			continue
+		}
+
+		var oldData, newData []byte
+		oldLabel, newLabel := "/dev/null", "/dev/null"
+
+		if c.Operation != "create" {
+			oldLabel = filepath.Join(targetDir, c.Path)
+			if oldData, err = os.ReadFile(oldLabel); err != nil {
+				return printed, err
+			}
+		}
+		if c.Operation != "delete" {
+			newLabel = filepath.Join(sourceDir, mappingSet.GetSourcePath(c.Path))
+			if newData, err = os.ReadFile(newLabel); err != nil {
+				return printed, err
+			}
+		}
+
+		text := diff.Files(oldLabel, newLabel, oldData, newData, diff.DefaultContext)
+		if text == "" {
+			continue
+		}
+		if printed > 0 {
+			fmt.Fprintln(output.Stdout)
+		}
+		fmt.Fprint(output.Stdout, diff.Colorize(text))
+		printed++
+	}
+
+	return printed, nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/sync"
+	"github.com/pt/ccd/internal/vcs"
+)
+
+// Outcomes of a doctor check.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+func newDoctorCmd(configPath string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the configuration and environment for problems",
+		Long: fmt.Sprintf(`Run a series of checks that catch problems before a deploy does: the
+config is valid (see ccd config validate), the mappings resolve, the source,
+target and backup directories are usable, there is room for backups, the
+latest snapshot is readable and the source is committed to git.
+
+Each check prints a pass, warn or fail line; anything but a pass comes
+with a hint on how to fix it. ccd doctor exits with status 1 when a
+check fails.
+
+Config: %s`, configPath),
+		Args: cobra.NoArgs,
+		RunE: runDoctor,
+	}
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	d := &doctor{}
+	if cfg := d.checkConfig(execPath); cfg != nil {
+		targetDir := cfg.Target
+		sourceDir := filepath.Join(workDir, cfg.Source)
+
+		d.checkPaths(cfg, sourceDir, targetDir)
+		d.checkBackups(cfg, targetDir)
+		d.checkSource(sourceDir)
+	}
+
+	output.Emit(output.EventChecks, d.results)
+
+	counts := map[string]int{}
+	for _, r := range d.results {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(output.Stdout, "\n%d passed, %d %s, %d failed\n",
+		counts[checkPass], counts[checkWarn], pluralize("warning", counts[checkWarn]), counts[checkFail])
+
+	if counts[checkFail] > 0 {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &exitCodeError{code: 1}
+	}
+	return nil
+}
+
+// doctor prints check results as they come in, grouped under headings.
+type doctor struct {
+	results []output.CheckResult
+	group   string
+}
+
+func (d *doctor) report(group, status, message, hint string) {
+	if group != d.group {
+		if d.group != "" {
+			fmt.Fprintln(output.Stdout)
+		}
+		fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, group))
+		d.group = group
+	}
+
+	icon := output.Colorize(output.Green, "✅")
+	switch status {
+	case checkWarn:
+		icon = output.Colorize(output.Yellow, "⚠️")
+	case checkFail:
+		icon = output.Colorize(output.Red, "❌")
+	}
+	fmt.Fprintf(output.Stdout, "  %s %s\n", icon, message)
+	if hint != "" {
+		fmt.Fprintf(output.Stdout, "     %s\n", output.Colorize(output.Cyan, "→ "+hint))
+	}
+
+	d.results = append(d.results, output.CheckResult{Group: group, Status: status, Message: message, Hint: hint})
+}
+
+// checkConfig reports on the config files and returns the loaded config,
+// or nil when it cannot be loaded.
+func (d *doctor) checkConfig(execPath string) *config.Config {
+	const group = "Config"
+
+	workDir, _ := os.Getwd()
+	files := config.Files(execPath, workDir)
+	if len(files) == 0 {
+		d.report(group, checkWarn, "No config file found, using the defaults",
+			fmt.Sprintf("Run ccd init to create %s", config.GetConfigOutputPath(execPath)))
+	}
+
+	for _, f := range files {
+		path := f.Path
+		d.report(group, checkPass, fmt.Sprintf("Config file: %s (%s)", path, f.Layer), "")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			d.report(group, checkFail, fmt.Sprintf("Cannot read config: %v", err), "Check the file's permissions")
+			return nil
+		}
+
+		warnings, err := config.Decode(path, data, config.Default())
+		for _, w := range warnings {
+			d.report(group, checkWarn, w.String(), "Rename the key in the config file")
+		}
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, issue := range invalid.Issues {
+				hint := "Fix the value in the config file"
+				if issue.Message == "unknown key" {
+					hint = "Remove the key or correct its spelling"
+				}
+				d.report(group, checkFail, issue.String(), hint)
+			}
+			return nil
+		}
+		if err != nil {
+			d.report(group, checkFail, fmt.Sprintf("Config does not parse: %v", err), fmt.Sprintf("Fix the YAML in %s", path))
+			return nil
+		}
+	}
+	if len(files) > 0 {
+		d.report(group, checkPass, "Config is valid", "")
+	}
+
+	cfg, err := config.Load(execPath, configOverrides()...)
+	if err != nil {
+		d.report(group, checkFail, fmt.Sprintf("Config does not load: %v", err), "Run ccd config validate")
+		return nil
+	}
+	return cfg
+}
+
+func (d *doctor) checkPaths(cfg *config.Config, sourceDir, targetDir string) {
+	const group = "Paths"
+
+	sourceOK := false
+	if info, err := os.Stat(sourceDir); err != nil || !info.IsDir() {
+		d.report(group, checkFail, fmt.Sprintf("Source directory does not exist: %s", sourceDir),
+			fmt.Sprintf("Run ccd from the directory containing %s, or set source in the config", cfg.Source))
+	} else {
+		sourceOK = true
+		d.report(group, checkPass, fmt.Sprintf("Source directory: %s", sourceDir), "")
+	}
+
+	if info, err := os.Stat(targetDir); err != nil || !info.IsDir() {
+		d.report(group, checkFail, fmt.Sprintf("Target directory does not exist: %s", targetDir),
+			"Create it, or set target in the config")
+	} else if err := checkWritable(targetDir); err != nil {
+		d.report(group, checkFail, fmt.Sprintf("Target directory is not writable: %s", targetDir),
+			"Fix the directory's permissions")
+	} else {
+		d.report(group, checkPass, fmt.Sprintf("Target directory is writable: %s", targetDir), "")
+	}
+
+	if len(cfg.Mappings) == 0 {
+		d.report(group, checkWarn, "No mappings: the whole source is deployed and sync mode may delete any target file",
+			"Add mappings to limit what ccd manages in the target")
+		return
+	}
+	if !sourceOK {
+		return
+	}
+	if _, err := sync.ResolveMappings(sourceDir, targetDir, cfg.Mappings); err != nil {
+		d.report(group, checkFail, err.Error(), "Fix or remove the mapping in the config")
+		return
+	}
+	d.report(group, checkPass, fmt.Sprintf("%d %s resolve", len(cfg.Mappings), pluralize("mapping", len(cfg.Mappings))), "")
+}
+
+func (d *doctor) checkBackups(cfg *config.Config, targetDir string) {
+	const group = "Backups"
+
+	if !cfg.Backup.Enabled {
+		d.report(group, checkWarn, "Backups are disabled, so deploys cannot be rolled back",
+			"Set backup.enabled to true")
+		return
+	}
+
+	if err := snapshotCompression(cfg.Backup).Validate(); err != nil {
+		d.report(group, checkFail, err.Error(), "Fix backup.format and backup.compression_level")
+	}
+	if _, err := backup.PolicyFromConfig(cfg.Backup); err != nil {
+		d.report(group, checkFail, err.Error(), "Fix the retention settings under backup")
+	}
+
+	store, err := openStore(cfg.Backup, "", targetDir)
+	if err != nil {
+		d.report(group, checkFail, err.Error(), "Fix the backup store settings")
+		return
+	}
+
+	if dir := localBackupDir(cfg.Backup); dir != "" {
+		d.checkBackupDir(cfg, dir, targetDir)
+	}
+
+	snapshots, err := backup.ListSnapshots(store)
+	if err != nil {
+		d.report(group, checkFail, fmt.Sprintf("Cannot list snapshots in %s: %v", store, err),
+			"Check that the backup store is reachable")
+		return
+	}
+	if len(snapshots) == 0 {
+		d.report(group, checkPass, "No snapshots yet", "")
+		return
+	}
+
+	latest := snapshots[0]
+	if latest.Encrypted && cfg.Backup.Encryption.KeyFile == "" && os.Getenv(passphraseEnv) == "" {
+		d.report(group, checkWarn, fmt.Sprintf("Latest snapshot %s is encrypted and was not verified", latest.Name),
+			fmt.Sprintf("Set %s, or run ccd backup verify", passphraseEnv))
+		return
+	}
+
+	archive, err := latest.Open(snapshotKeys(cfg.Backup))
+	var files int
+	if err == nil {
+		files, err = archive.Verify()
+		archive.Close()
+	}
+	if err != nil {
+		d.report(group, checkFail, fmt.Sprintf("Latest snapshot %s is unreadable: %v", latest.Name, err),
+			"Take a fresh snapshot with ccd backup create")
+		return
+	}
+	d.report(group, checkPass, fmt.Sprintf("Latest snapshot %s is readable (%d %s, %s)",
+		latest.Name, files, pluralize("file", files), formatAge(latest.Timestamp)), "")
+}
+
+// checkBackupDir checks that snapshots can be written to dir and that
+// there is room for the ones retention keeps.
+func (d *doctor) checkBackupDir(cfg *config.Config, dir, targetDir string) {
+	const group = "Backups"
+
+	existing := dir
+	for {
+		if _, err := os.Stat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	if err := checkWritable(existing); err != nil {
+		d.report(group, checkFail, fmt.Sprintf("Backup directory is not writable: %s", dir),
+			"Fix the directory's permissions, or set backup.dir")
+		return
+	}
+	if existing != dir {
+		d.report(group, checkPass, fmt.Sprintf("Backup directory will be created: %s", dir), "")
+	} else {
+		d.report(group, checkPass, fmt.Sprintf("Backup directory is writable: %s", dir), "")
+	}
+
+	contents, err := backup.ScanTarget(targetDir, cfg.Mappings, cfg.Backup.ExtraPaths)
+	if err != nil {
+		return
+	}
+	var size int64
+	for _, f := range contents.Files() {
+		size += f.Size
+	}
+
+	free, err := freeSpace(existing)
+	if err != nil {
+		d.report(group, checkWarn, fmt.Sprintf("Cannot check free space for backups: %v", err), "")
+		return
+	}
+
+	kept := int64(cfg.Backup.MaxSnapshots)
+	if cfg.Backup.KeepLast > 0 {
+		kept = int64(cfg.Backup.KeepLast)
+	}
+	kept = max(kept, 1)
+
+	message := fmt.Sprintf("%s free for backups; a snapshot holds up to %s",
+		backup.FormatSize(int64(free)), backup.FormatSize(size))
+	switch {
+	case int64(free) < size:
+		d.report(group, checkFail, message, "Free up disk space, or move backup.dir to a larger disk")
+	case int64(free) < size*kept:
+		d.report(group, checkWarn, message,
+			fmt.Sprintf("Free up disk space to keep %d snapshots, or lower backup.max_snapshots", kept))
+	default:
+		d.report(group, checkPass, message, "")
+	}
+}
+
+func (d *doctor) checkSource(sourceDir string) {
+	const group = "Source"
+
+	if _, err := os.Stat(sourceDir); err != nil {
+		return
+	}
+
+	status, err := vcs.Describe(sourceDir)
+	if err != nil {
+		d.report(group, checkWarn, "Source is not in a git repository",
+			"Track it in git so snapshots record the commit they were deployed from")
+		return
+	}
+
+	at := fmt.Sprintf("%s at %s", status.Branch, shortCommit(status.Commit))
+	if status.Dirty {
+		d.report(group, checkWarn, fmt.Sprintf("Source has uncommitted changes (%s)", at),
+			"Commit them so snapshots record exactly what was deployed")
+		return
+	}
+	d.report(group, checkPass, fmt.Sprintf("Source is committed (%s)", at), "")
+}
+
+// localBackupDir returns the directory the default backup store writes
+// to, or "" when it is not local.
+func localBackupDir(cfg config.BackupConfig) string {
+	if cfg.Backend == backup.BackendGit {
+		return cfg.Dir
+	}
+
+	name := cfg.Store
+	if name == "" {
+		name = backup.DefaultStoreName
+	}
+	sc, ok := cfg.Stores[name]
+	if !ok {
+		// As in backup.StoreFromConfig, an undefined local store is backup.dir
+		if name == backup.DefaultStoreName {
+			return cfg.Dir
+		}
+		return ""
+	}
+	if sc.Type == "" || sc.Type == "local" {
+		return config.ExpandPath(sc.Dir)
+	}
+	return ""
+}
+
+// checkWritable creates and removes a file in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ccd-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func TestLocalBackupDir(t *testing.T) {
+	s3 := map[string]config.StoreConfig{"remote": {Type: "s3", Bucket: "backups"}}
+
+	tests := []struct {
+		name string
+		cfg  config.BackupConfig
+		want string
+	}{
+		{"default store", config.BackupConfig{Dir: "/backups"}, "/backups"},
+		{"local store by name", config.BackupConfig{Dir: "/backups", Store: "local", Stores: s3}, "/backups"},
+		{"defined local store", config.BackupConfig{Dir: "/backups", Store: "local", Stores: map[string]config.StoreConfig{"local": {Dir: "/elsewhere"}}}, "/elsewhere"},
+		{"remote store", config.BackupConfig{Dir: "/backups", Store: "remote", Stores: s3}, ""},
+		{"unknown store", config.BackupConfig{Dir: "/backups", Store: "missing"}, ""},
+		{"git backend", config.BackupConfig{Dir: "/backups", Backend: "git", Store: "remote", Stores: s3}, "/backups"},
+	}
+	for _, tt := range tests {
+		if got := localBackupDir(tt.cfg); got != tt.want {
+			t.Errorf("%s: localBackupDir() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
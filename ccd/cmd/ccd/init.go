@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/prompt"
+	"github.com/pt/ccd/internal/sync"
+)
+
+func runInitWizard(configPath string) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	if err := initWizard(prompt.Stdin, configPath, workDir); err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	return nil
+}
+
+// initWizard writes a config to configPath from the answers to ask, with
+// a mapping proposed for each top-level entry of the source directory.
+func initWizard(ask *prompt.Asker, configPath, workDir string) error {
+	if _, err := os.Stat(configPath); err == nil {
+		replace, err := ask.YesNo(fmt.Sprintf("%s already exists. Replace it?", configPath), false)
+		if err != nil {
+			return err
+		}
+		if !replace {
+			output.PrintWarning("Aborted by user")
+			return nil
+		}
+	}
+
+	cfg := config.GeneratedDefaults()
+	var err error
+
+	fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, "Directories"))
+	if cfg.Source, err = ask.Text("  Source directory, relative to the working directory", cfg.Source); err != nil {
+		return err
+	}
+	if cfg.Target, err = ask.Text("  Target directory", cfg.Target); err != nil {
+		return err
+	}
+	sourceDir := filepath.Join(workDir, cfg.Source)
+	targetDir := config.ExpandPath(cfg.Target)
+
+	fmt.Fprintln(output.Stdout)
+	fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, "Mappings"))
+	if cfg.Mappings, err = askMappings(ask, sourceDir, targetDir, cfg.IgnorePatterns); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(output.Stdout)
+	fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, "Backups"))
+	if cfg.Backup.Enabled, err = ask.YesNo("  Back up the target before each deploy?", cfg.Backup.Enabled); err != nil {
+		return err
+	}
+	if cfg.Backup.Enabled {
+		if cfg.Backup.Dir, err = ask.Text("  Backup directory", cfg.Backup.Dir); err != nil {
+			return err
+		}
+		if cfg.Backup.MaxSnapshots, err = ask.Number("  Snapshots to keep", cfg.Backup.MaxSnapshots, 1); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(output.Stdout)
+	fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, "Deploys"))
+	fmt.Fprintln(output.Stdout, "  merge adds and updates files; sync also deletes target files missing from the source")
+	if cfg.DefaultMode, err = ask.Choose("  Default mode", []string{"merge", "sync"}, cfg.DefaultMode); err != nil {
+		return err
+	}
+	if cfg.ConfirmDeletes, err = ask.YesNo("  Ask before deleting files in sync mode?", cfg.ConfirmDeletes); err != nil {
+		return err
+	}
+
+	content, err := config.Generate(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		return &config.ConfigWriteError{Path: configPath, Cause: err}
+	}
+
+	fmt.Fprintf(output.Stdout, "\n%s Created: %s\n", output.Colorize(output.Green, "✅"), configPath)
+	fmt.Fprintln(output.Stdout, "  Review it, then preview a deploy with: ccd --dry-run")
+	return nil
+}
+
+// askMappings proposes a mapping for each top-level entry of sourceDir,
+// noting whether targetDir already has it, and returns the accepted ones.
+func askMappings(ask *prompt.Asker, sourceDir, targetDir string, ignorePatterns []string) ([]config.Mapping, error) {
+	sourceEntries, err := topLevelEntries(sourceDir, ignorePatterns)
+	if err != nil {
+		output.PrintWarning(fmt.Sprintf("Cannot read the source directory, no mappings proposed: %v", err))
+		return nil, nil
+	}
+	if len(sourceEntries) == 0 {
+		output.PrintWarning(fmt.Sprintf("Source directory is empty: %s", sourceDir))
+		return nil, nil
+	}
+
+	targetEntries, err := topLevelEntries(targetDir, ignorePatterns)
+	if err != nil {
+		output.PrintInfo(fmt.Sprintf("Target directory does not exist yet: %s", targetDir))
+	}
+	inTarget := make(map[string]bool, len(targetEntries))
+	for _, name := range targetEntries {
+		inTarget[name] = true
+	}
+
+	var mappings []config.Mapping
+	mapped := make(map[string]bool)
+	for _, name := range sourceEntries {
+		note := "new in the target"
+		if inTarget[name] {
+			note = "updates the target's copy"
+		}
+		deploy, err := ask.YesNo(fmt.Sprintf("  Deploy %s (%s)?", name, note), true)
+		if err != nil {
+			return nil, err
+		}
+		if deploy {
+			mappings = append(mappings, config.Mapping{Source: name, Target: name})
+			mapped[name] = true
+		}
+	}
+
+	var unmanaged []string
+	for _, name := range targetEntries {
+		if !mapped[name] {
+			unmanaged = append(unmanaged, name)
+		}
+	}
+	if len(unmanaged) > 0 {
+		fmt.Fprintf(output.Stdout, "  Left alone in the target: %s\n", strings.Join(unmanaged, ", "))
+	}
+	if len(mappings) == 0 {
+		output.PrintWarning("No mappings: the whole source directory is deployed and sync mode may delete any target file")
+	}
+
+	return mappings, nil
+}
+
+// topLevelEntries lists the entries of dir that are not ignored, with a
+// trailing slash on directories as in mappings.
+func topLevelEntries(dir string, ignorePatterns []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if sync.ShouldIgnore(e.Name(), ignorePatterns) {
+			continue
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
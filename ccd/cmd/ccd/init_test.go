@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/prompt"
+)
+
+func runResetConfigWithPath(configPath string) error {
+	content := config.GenerateDefault()
+	return os.WriteFile(configPath, []byte(content), 0644)
+}
+
+func TestRunResetConfig_CreatesFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	err := runResetConfigWithPath(configPath)
+	if err != nil {
+		t.Fatalf("runResetConfig() failed: %v", err)
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		t.Error("runResetConfig() did not create config file")
+	}
+}
+
+func TestRunResetConfig_OverwritesExisting(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	if err := os.WriteFile(configPath, []byte("existing"), 0644); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+
+	err := runResetConfigWithPath(configPath)
+	if err != nil {
+		t.Fatalf("runResetConfig() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+
+	if string(content) == "existing" {
+		t.Error("runResetConfig() did not overwrite file")
+	}
+}
+
+func TestRunResetConfig_OutputContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	err := runResetConfigWithPath(configPath)
+	if err != nil {
+		t.Fatalf("runResetConfig() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+
+	expected := config.GenerateDefault()
+	if string(content) != expected {
+		t.Errorf("Config file content does not match GenerateDefault()\ngot:\n%s\nwant:\n%s", string(content), expected)
+	}
+}
+
+func TestInitWizard_ProposesSourceEntries(t *testing.T) {
+	workDir := t.TempDir()
+	targetDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	for _, dir := range []string{"claude-files/skills", "claude-files/commands", "claude-files/.git"} {
+		if err := os.MkdirAll(filepath.Join(workDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"claude-files/CLAUDE.md", "claude-files/notes.tmp"} {
+		if err := os.WriteFile(filepath.Join(workDir, file), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Source, target; CLAUDE.md, commands/, skills/; backups, dir, count;
+	// mode, confirm deletes
+	answers := strings.Join([]string{"", targetDir, "y", "n", "", "y", "", "3", "sync", "n"}, "\n") + "\n"
+	ask := prompt.NewAsker(strings.NewReader(answers), io.Discard)
+	if err := initWizard(ask, configPath, workDir); err != nil {
+		t.Fatalf("initWizard() error = %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("config not written: %v", err)
+	}
+	cfg := config.Default()
+	if _, err := config.Decode(configPath, data, cfg); err != nil {
+		t.Fatalf("written config does not decode: %v", err)
+	}
+
+	var mapped []string
+	for _, m := range cfg.Mappings {
+		mapped = append(mapped, m.Source)
+	}
+	if got := strings.Join(mapped, ","); got != "CLAUDE.md,skills/" {
+		t.Errorf("mappings = %s, want CLAUDE.md,skills/", got)
+	}
+	if cfg.Target != targetDir || !cfg.Backup.Enabled || cfg.Backup.MaxSnapshots != 3 ||
+		cfg.DefaultMode != "sync" || cfg.ConfirmDeletes {
+		t.Errorf("config = %+v", *cfg)
+	}
+	if !strings.Contains(string(data), "# Prompt for confirmation before deleting files in sync mode\n") {
+		t.Error("written config lost its comments")
+	}
+}
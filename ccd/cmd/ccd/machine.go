@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/sync"
+)
+
+// emitPlan reports the changes of a deploy, ordered by path, and their
+// summary.
+func emitPlan(changes []output.FileChange) {
+	sorted := make([]output.FileChange, len(changes))
+	copy(sorted, changes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	var summary output.Summary
+	for _, c := range changes {
+		summary.Add(c.Operation)
+	}
+
+	output.Emit(output.EventPlan, sorted)
+	output.Emit(output.EventSummary, summary)
+}
+
+// snapshotInfo describes a snapshot for the machine-readable output. The
+// store is omitted when nil.
+func snapshotInfo(s *backup.Snapshot, store backup.Store) output.SnapshotInfo {
+	info := output.SnapshotInfo{
+		Name:      s.Name,
+		Timestamp: s.Timestamp,
+		Size:      s.Size,
+		Target:    s.TargetDir,
+		Reason:    s.Metadata.Reason,
+		Label:     s.Metadata.Label,
+		Mode:      s.Metadata.Mode,
+		Encrypted: s.Encrypted,
+		Commit:    s.Commit,
+	}
+	if store != nil {
+		info.Store = store.String()
+	}
+	return info
+}
+
+func emitSnapshots(snapshots []backup.Snapshot, store backup.Store) {
+	infos := make([]output.SnapshotInfo, len(snapshots))
+	for i := range snapshots {
+		infos[i] = snapshotInfo(&snapshots[i], store)
+	}
+	output.Emit(output.EventSnapshots, infos)
+}
+
+func emitStatus(statuses []sync.MappingStatus) {
+	infos := make([]output.MappingStatusInfo, len(statuses))
+	for i, s := range statuses {
+		state := "in_sync"
+		if len(s.Drifted) > 0 {
+			state = "drifted"
+		} else if s.Pending > 0 {
+			state = "pending"
+		}
+		infos[i] = output.MappingStatusInfo{
+			Mapping: s.Mapping,
+			Target:  s.Target,
+			State:   state,
+			Pending: s.Pending,
+			Drifted: nonNil(s.Drifted),
+		}
+	}
+	output.Emit(output.EventStatus, infos)
+}
+
+// nonNil returns names, or an empty slice in place of nil so that it is
+// encoded as [] rather than null.
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/prompt"
+	"github.com/pt/ccd/internal/sync"
+)
+
+var (
+	version = "1.0.0"
+
+	flagSync    bool
+	flagDryRun  bool
+	flagTarget  string
+	flagNoColor bool
+	flagYes     bool
+	flagOutput  string
+	flagList    bool
+	flagPaths   []string
+	flagLabel   string
+	flagReason  string
+	flagBefore  string
+
+	flagIncludeExtra bool
+	flagUndo         bool
+	flagStore        string
+	flagFromTarget   string
+	flagInto         string
+
+	flagInteractive bool
+)
+
+func getConfigPath() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+	return config.GetConfigOutputPath(execPath)
+}
+
+func main() {
+	configPath := getConfigPath()
+
+	rootCmd := &cobra.Command{
+		Use:   "ccd",
+		Short: "Claude Code Deploy - File synchronization tool",
+		Long: fmt.Sprintf(`Deploy claude-code-stuff configuration to target directory with tree-view output and rollback support.
+
+Config: %s`, configPath),
+		RunE: runDeploy,
+	}
+
+	rootCmd.Flags().BoolVar(&flagSync, "sync", false, "Remove files from destination that no longer exist in source")
+	rootCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Preview changes without making them")
+	rootCmd.Flags().BoolVar(&flagShowDiff, "show-diff", false, "Show the content changes of each file before applying")
+	rootCmd.Flags().BoolVarP(&flagInteractive, "interactive", "i", false, "Choose which changes to apply, file by file")
+	rootCmd.PersistentFlags().StringVar(&flagTarget, "target", "", "Override target directory")
+	rootCmd.PersistentFlags().BoolVar(&flagNoColor, "no-color", false, "Disable colored output")
+	rootCmd.PersistentFlags().BoolVar(&flagYes, "yes", false, "Skip confirmation prompts")
+	rootCmd.PersistentFlags().StringVar(&flagOutput, "output", output.FormatText,
+		"Output format: text, json (one document) or ndjson (one event per line); messages go to stderr")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		output.SetCommand(cmd.CommandPath())
+		return output.SetFormat(flagOutput)
+	}
+	rootCmd.Flags().StringVar(&flagLabel, "label", "", "Label the backup snapshot taken before deploying (protects it from pruning)")
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback [snapshot]",
+		Short: "Restore from a backup snapshot",
+		Long: fmt.Sprintf(`Restore the target directory from a previous backup snapshot.
+
+Without a snapshot the newest one is restored. Select another by its name
+or any unique part of it such as its ID, or relative to the newest: @1 is
+the previous snapshot, @2 the one before. With backup.backend set to git,
+a snapshot's commit id (or a prefix of it) selects it too. --label, --reason and --before
+narrow the candidates, e.g. --before "2026-10-01" restores the newest
+snapshot taken before that date.
+
+Use --path (repeatable, globs allowed) to restore only part of a snapshot,
+e.g. --path skills/tdd --path CLAUDE.md.
+
+With backup.enabled, the current state is saved as a pre-rollback
+snapshot before restoring, so a rollback can be reverted with --undo.
+Pre-rollback snapshots are pruned like those of deploys.
+
+Use --store to list or restore snapshots from another store configured
+under backup.stores, e.g. a shared S3 bucket.
+
+Snapshots are kept per target directory, and only those of the current
+target are listed and restored. Use --from-target to restore a snapshot
+of another target into this one.
+
+Use --into to write a snapshot into another directory for inspection
+instead, e.g. --into /tmp/inspect. The target is left alone and nothing
+is asked or deleted.
+
+Config: %s`, configPath),
+		RunE: runRollback,
+	}
+	rollbackCmd.Flags().BoolVar(&flagList, "list", false, "List available snapshots")
+	rollbackCmd.Flags().StringVar(&flagReason, "reason", "", "Only list or restore snapshots taken for this reason (deploy, rollback, manual)")
+	rollbackCmd.Flags().StringVar(&flagLabel, "label", "", "Only list or restore snapshots with this label")
+	rollbackCmd.Flags().StringVar(&flagBefore, "before", "", "Only list or restore snapshots taken before this date or time")
+	rollbackCmd.Flags().StringArrayVar(&flagPaths, "path", nil, "Restore only entries matching this target-relative path or glob (repeatable)")
+	rollbackCmd.Flags().BoolVar(&flagIncludeExtra, "include-extra", false, "Also restore files captured from backup.extra_paths")
+	rollbackCmd.Flags().BoolVar(&flagUndo, "undo", false, "Return to the state just before the last rollback")
+	rollbackCmd.Flags().StringVar(&flagStore, "store", "", "Restore from this configured backup store instead of the default")
+	rollbackCmd.Flags().StringVar(&flagFromTarget, "from-target", "", "List or restore snapshots taken of another target directory")
+	rollbackCmd.Flags().StringVar(&flagInto, "into", "", "Extract the snapshot into this directory instead of restoring the target")
+	rootCmd.AddCommand(rollbackCmd)
+
+	rootCmd.AddCommand(newBackupCmd(configPath))
+	rootCmd.AddCommand(newStatusCmd(configPath))
+	rootCmd.AddCommand(newDiffCmd(configPath))
+	rootCmd.AddCommand(newWatchCmd(configPath))
+	rootCmd.AddCommand(newDoctorCmd(configPath))
+
+	rootCmd.AddCommand(newConfigCmd(configPath))
+
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show version information",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprintf(output.Stdout, "ccd version %s\n", version)
+			output.Emit(output.EventVersion, output.VersionInfo{Version: version})
+		},
+	}
+	rootCmd.AddCommand(versionCmd)
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize or upgrade config.yaml",
+		Long: fmt.Sprintf(`Initialize config.yaml with default values and comprehensive comments.
+If config already exists, it is migrated to the current version instead
+(see ccd config migrate), keeping your settings and comments.
+
+With --interactive, a wizard scans the source directory and the current
+target, proposes a mapping for each top-level entry, asks about backups,
+the default mode and delete confirmation, and writes a commented config
+with your answers.
+
+Config: %s`, configPath),
+		RunE: runInit,
+	}
+	initCmd.Flags().BoolVarP(&flagInteractive, "interactive", "i", false, "Build the config with a wizard that scans the source directory")
+	rootCmd.AddCommand(initCmd)
+
+	err := rootCmd.Execute()
+	var exitErr *exitCodeError
+	if err != nil && !errors.As(err, &exitErr) {
+		output.Emit(output.EventError, output.ErrorInfo{Message: err.Error()})
+	}
+	output.Flush()
+
+	if exitErr != nil {
+		os.Exit(exitErr.code)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func runDeploy(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	if flagInteractive && (flagDryRun || flagYes) {
+		err := fmt.Errorf("--interactive cannot be combined with --dry-run or --yes")
+		output.PrintError(err.Error())
+		return err
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	files := config.Files(execPath, workDir)
+	if len(files) == 0 {
+		configPath := config.GetConfigOutputPath(execPath)
+		output.PrintInfo("No config.yaml found, generating default...")
+		content := config.GenerateDefault()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			output.PrintError(fmt.Sprintf("Failed to generate config: %v", err))
+			return err
+		}
+		fmt.Fprintf(output.Stdout, "  Created: %s\n", configPath)
+		fmt.Fprintln(output.Stdout, "\nPlease review the configuration and run again.")
+		return nil
+	}
+
+	cfg, err := config.Load(execPath, configOverrides()...)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to load config: %v", err))
+		return err
+	}
+
+	sourceDir := filepath.Join(workDir, cfg.Source)
+	if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
+		output.PrintError(fmt.Sprintf("Source directory does not exist: %s", sourceDir))
+		return err
+	}
+
+	targetDir := cfg.Target
+
+	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+		output.PrintError(fmt.Sprintf("Target directory does not exist: %s", targetDir))
+		return err
+	}
+
+	output.PrintMode(flagDryRun, flagSync)
+	for _, f := range files {
+		fmt.Fprintf(output.Stdout, "Config: %s\n", output.Colorize(output.Blue, f.Path))
+	}
+	output.PrintPaths(sourceDir, targetDir)
+
+	if flagSync && len(cfg.Mappings) == 0 {
+		output.PrintWarning("Sync mode without mappings - ALL unmapped target files may be deleted")
+	}
+
+	syncResult, err := sync.Sync(sync.SyncOptions{
+		SourceDir:      sourceDir,
+		TargetDir:      targetDir,
+		Mappings:       cfg.Mappings,
+		IgnorePatterns: cfg.IgnorePatterns,
+		SyncMode:       flagSync,
+		DryRun:         true,
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to calculate changes: %v", err))
+		return err
+	}
+
+	emitPlan(syncResult.Changes)
+
+	if !syncResult.Summary.HasChanges() {
+		output.PrintInfo("No changes detected")
+		return nil
+	}
+
+	tree := output.BuildTree(syncResult.Changes, targetDir)
+	output.PrintTreeHeader(targetDir)
+	fmt.Fprint(output.Stdout, output.RenderTree(tree, "", true))
+
+	syncResult.Summary.Print()
+
+	if flagShowDiff {
+		fmt.Fprintln(output.Stdout)
+		if _, err := printChangeDiffs(syncResult.Changes, sourceDir, targetDir, cfg.Mappings); err != nil {
+			output.PrintError(fmt.Sprintf("Failed to show diff: %v", err))
+			return err
+		}
+	}
+
+	if flagDryRun {
+		output.PrintSuccess(true)
+		return nil
+	}
+
+	// selected is nil unless changes were chosen interactively
+	var selected map[string]bool
+	if flagInteractive {
+		selected, err = prompt.SelectChanges(sync.Selectable(syncResult.Changes), func(c output.FileChange) {
+			fmt.Fprintln(output.Stdout)
+			if _, err := printChangeDiffs([]output.FileChange{c}, sourceDir, targetDir, cfg.Mappings); err != nil {
+				output.PrintError(fmt.Sprintf("Failed to show diff: %v", err))
+			}
+			fmt.Fprintln(output.Stdout)
+		})
+		if err != nil {
+			output.PrintError(err.Error())
+			return err
+		}
+
+		syncResult.Changes = sync.Subset(syncResult.Changes, selected)
+		syncResult.Summary = output.Summary{}
+		for _, c := range syncResult.Changes {
+			syncResult.Summary.Add(c.Operation)
+		}
+		emitPlan(syncResult.Changes)
+
+		if !syncResult.Summary.HasChanges() {
+			fmt.Fprintln(output.Stdout)
+			output.PrintInfo("No changes selected")
+			return nil
+		}
+		syncResult.Summary.Print()
+	}
+
+	if flagSync && cfg.ConfirmDeletes && !flagInteractive {
+		deletions := sync.GetDeletions(syncResult.Changes)
+		if len(deletions) > 0 {
+			if !prompt.ConfirmDeletes(deletions, flagYes) {
+				output.PrintWarning("Aborted by user")
+				return nil
+			}
+		}
+	}
+
+	if cfg.Backup.Enabled {
+		fmt.Fprintln(output.Stdout)
+		output.PrintInfo("Creating backup snapshot...")
+		metadata := snapshotMetadata(backup.ReasonDeploy, sourceDir)
+		metadata.Label = flagLabel
+		metadata.Mode = "merge"
+		if flagSync {
+			metadata.Mode = "sync"
+		}
+		metadata.Changes = &backup.ChangeSummary{
+			Created: syncResult.Summary.Created,
+			Updated: syncResult.Summary.Updated,
+			Deleted: syncResult.Summary.Deleted,
+		}
+
+		// Cover exactly the paths a partial deploy changes
+		mappings := cfg.Mappings
+		if selected != nil {
+			mappings = nil
+			for _, root := range sync.Roots(syncResult.Changes) {
+				mappings = append(mappings, config.Mapping{Source: root, Target: root})
+			}
+		}
+
+		var snapshot *backup.Snapshot
+		store, err := openStore(cfg.Backup, "", targetDir)
+		if err == nil {
+			snapshot, err = backup.CreateSnapshot(backup.SnapshotOptions{
+				TargetDir:   targetDir,
+				Store:       store,
+				Mappings:    mappings,
+				ExtraPaths:  cfg.Backup.ExtraPaths,
+				Metadata:    metadata,
+				Encryption:  snapshotEncryption(cfg.Backup, snapshotKeys(cfg.Backup)),
+				Compression: snapshotCompression(cfg.Backup),
+			})
+		}
+		if err != nil {
+			output.PrintWarning(fmt.Sprintf("Failed to create backup: %v", err))
+		} else {
+			fmt.Fprintf(output.Stdout, "  Backup created: %s (%s)\n", snapshot.Name, backup.FormatSize(snapshot.Size))
+			output.Emit(output.EventBackup, snapshotInfo(snapshot, store))
+
+			reportPrune(store, cfg.Backup)
+		}
+	}
+
+	fmt.Fprintln(output.Stdout)
+	output.PrintInfo("Applying changes...")
+
+	_, err = sync.Sync(sync.SyncOptions{
+		SourceDir:      sourceDir,
+		TargetDir:      targetDir,
+		Mappings:       cfg.Mappings,
+		IgnorePatterns: cfg.IgnorePatterns,
+		SyncMode:       flagSync,
+		DryRun:         false,
+		Select:         selected,
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to sync: %v", err))
+		return err
+	}
+
+	output.PrintSuccess(false)
+	return nil
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		execPath = os.Args[0]
+	}
+
+	cfg, err := config.Load(execPath, configOverrides()...)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to load config: %v", err))
+		return err
+	}
+
+	targetDir := cfg.Target
+
+	// Snapshots are restored from --store and --from-target; pre-rollback
+	// snapshots always go to the target's namespace in the default store,
+	// where --undo looks for them
+	sourceTarget := targetDir
+	if flagFromTarget != "" {
+		sourceTarget = config.ExpandPath(flagFromTarget)
+	}
+	store, err := openStore(cfg.Backup, flagStore, sourceTarget)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+	defaultStore, err := openStore(cfg.Backup, "", targetDir)
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	filter := backup.SnapshotFilter{Reason: flagReason, Label: flagLabel}
+	if flagBefore != "" {
+		if filter.Before, err = backup.ParseBefore(flagBefore); err != nil {
+			output.PrintError(err.Error())
+			return err
+		}
+	}
+
+	if flagList {
+		snapshots, err := backup.ListSnapshots(store)
+		if err != nil {
+			output.PrintError(fmt.Sprintf("Failed to list snapshots: %v", err))
+			return err
+		}
+
+		var matched []backup.Snapshot
+		for _, s := range snapshots {
+			if filter.Match(s) {
+				matched = append(matched, s)
+			}
+		}
+
+		emitSnapshots(matched, store)
+
+		if len(matched) == 0 {
+			output.PrintInfo("No snapshots found")
+			return nil
+		}
+
+		fmt.Fprintln(output.Stdout, output.Colorize(output.Blue, fmt.Sprintf("Available snapshots of %s:", sourceTarget)))
+		for _, s := range matched {
+			age := formatAge(s.Timestamp)
+			fmt.Fprintf(output.Stdout, "  %s (%s, %s)\n", s.Name, backup.FormatSize(s.Size), age)
+			if details := formatSnapshotDetails(s); details != "" {
+				fmt.Fprintf(output.Stdout, "      %s\n", details)
+			}
+		}
+		return nil
+	}
+
+	var snapshot *backup.Snapshot
+	keys := snapshotKeys(cfg.Backup)
+	restoreOpts := backup.RestoreOptions{Paths: flagPaths, IncludeExtra: flagIncludeExtra, Keys: keys}
+
+	if flagUndo {
+		if len(args) > 0 || len(flagPaths) > 0 || flagIncludeExtra || flagStore != "" || flagFromTarget != "" ||
+			flagReason != "" || flagLabel != "" || flagBefore != "" || flagInto != "" {
+			err := fmt.Errorf("--undo cannot be combined with a snapshot, --path, --include-extra, --store, --from-target, --into or snapshot filters")
+			output.PrintError(err.Error())
+			return err
+		}
+
+		snapshot, err = backup.LatestSnapshot(defaultStore, backup.SnapshotFilter{Reason: backup.ReasonRollback})
+		if err != nil {
+			err = fmt.Errorf("nothing to undo: no pre-rollback snapshots found")
+			output.PrintError(err.Error())
+			return err
+		}
+
+		// Undo with the same scope the rollback was performed with
+		if info := snapshot.Metadata.Rollback; info != nil {
+			restoreOpts = backup.RestoreOptions{Paths: info.Paths, IncludeExtra: info.IncludeExtra, Keys: keys}
+		}
+	} else {
+		var identifier string
+		if len(args) > 0 {
+			identifier = args[0]
+		}
+
+		snapshot, err = backup.SelectSnapshot(store, identifier, filter)
+		if err != nil {
+			output.PrintError(err.Error())
+			var ambiguous *backup.AmbiguousSnapshotError
+			if flagFromTarget == "" && !errors.As(err, &ambiguous) {
+				output.PrintInfo("Only snapshots of " + targetDir + " are searched; use --from-target to restore one of another target")
+			}
+			return err
+		}
+
+		if flagInto != "" {
+			return extractSnapshot(snapshot, config.ExpandPath(flagInto), keys)
+		}
+
+		if snapshot.TargetDir != "" && !backup.SameTarget(snapshot.TargetDir, targetDir) && flagFromTarget == "" {
+			err := fmt.Errorf("%s was taken of %s, not %s; pass --from-target %s to restore it here",
+				snapshot.Name, snapshot.TargetDir, targetDir, snapshot.TargetDir)
+			output.PrintError(err.Error())
+			return err
+		}
+	}
+
+	plan, err := backup.PlanRestore(snapshot, targetDir, restoreOpts)
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to read snapshot: %v", err))
+		return err
+	}
+	changes := plan.Changes
+
+	if len(restoreOpts.Paths) > 0 && len(changes) == 0 {
+		err := fmt.Errorf("no files in %s match the given paths", snapshot.Name)
+		output.PrintError(err.Error())
+		if plan.SkippedExtra > 0 {
+			output.PrintInfo("Matching files are in the extra paths scope; add --include-extra to restore them")
+		}
+		return err
+	}
+
+	fmt.Fprintf(output.Stdout, "Restoring from: %s\n", output.Colorize(output.Cyan, snapshot.Name))
+	if flagStore != "" {
+		fmt.Fprintf(output.Stdout, "Store: %s (%s)\n", flagStore, store)
+	}
+	if !backup.SameTarget(sourceTarget, targetDir) {
+		fmt.Fprintf(output.Stdout, "From target: %s\n", output.Colorize(output.Yellow, sourceTarget))
+	}
+	fmt.Fprintf(output.Stdout, "Target: %s\n\n", output.Colorize(output.Blue, targetDir))
+
+	tree := output.BuildTree(changes, targetDir)
+	output.PrintTreeHeader(targetDir)
+	fmt.Fprint(output.Stdout, output.RenderTree(tree, "", true))
+
+	var summary output.Summary
+	removals := 0
+	for _, c := range changes {
+		summary.Add(c.Operation)
+		if c.Operation == "delete" {
+			removals++
+		}
+	}
+	summary.Print()
+	fmt.Fprintln(output.Stdout)
+
+	if plan.SkippedExtra > 0 {
+		output.PrintInfo(fmt.Sprintf("Skipping %d %s from extra paths (use --include-extra to restore them)",
+			plan.SkippedExtra, pluralize("file", plan.SkippedExtra)))
+		fmt.Fprintln(output.Stdout)
+	}
+
+	message := "This will replace all files in the target. Continue?"
+	if len(restoreOpts.Paths) > 0 {
+		message = "This will replace the selected files in the target. Continue?"
+	}
+	if removals > 0 {
+		message = fmt.Sprintf("This will restore the snapshot and delete %d %s it does not contain. Continue?",
+			removals, pluralize("file", removals))
+	}
+	if !prompt.Confirm(output.Colorize(output.Yellow, "⚠️")+" "+message, flagYes) {
+		output.PrintWarning("Aborted by user")
+		return nil
+	}
+
+	// Without backups there is nothing to undo the rollback with
+	var safety *backup.Snapshot
+	var safetyInfo *output.SnapshotInfo
+	if cfg.Backup.Enabled {
+		output.PrintInfo("Creating pre-rollback snapshot...")
+
+		metadata := snapshotMetadata(backup.ReasonRollback, "")
+		metadata.Rollback = &backup.RollbackInfo{
+			From:         snapshot.Name,
+			Paths:        restoreOpts.Paths,
+			IncludeExtra: restoreOpts.IncludeExtra,
+		}
+
+		safety, err = backup.CreateSnapshot(backup.SnapshotOptions{
+			TargetDir:   targetDir,
+			Store:       defaultStore,
+			Mappings:    cfg.Mappings,
+			ExtraPaths:  cfg.Backup.ExtraPaths,
+			Metadata:    metadata,
+			Encryption:  snapshotEncryption(cfg.Backup, keys),
+			Compression: snapshotCompression(cfg.Backup),
+		})
+		if err != nil {
+			output.PrintError(fmt.Sprintf("Failed to create pre-rollback snapshot, target left untouched: %v", err))
+			return err
+		}
+		fmt.Fprintf(output.Stdout, "  Backup created: %s (%s)\n\n", safety.Name, backup.FormatSize(safety.Size))
+		info := snapshotInfo(safety, defaultStore)
+		safetyInfo = &info
+		output.Emit(output.EventBackup, info)
+	}
+
+	output.PrintInfo("Restoring snapshot...")
+
+	if err := backup.RestoreSnapshot(snapshot, targetDir, restoreOpts); err != nil {
+		output.PrintError(fmt.Sprintf("Failed to restore: %v", err))
+		if safety != nil {
+			fmt.Fprintf(output.Stdout, "  The previous state is saved in %s\n", safety.Name)
+		}
+		return err
+	}
+
+	fmt.Fprintf(output.Stdout, "\n%s Restored successfully from %s\n",
+		output.Colorize(output.Green, "✅"),
+		snapshot.Name)
+	if safety != nil {
+		fmt.Fprintf(output.Stdout, "  Undo with: ccd rollback --undo\n")
+		// Only now, as pruning may remove the snapshot just restored
+		reportPrune(defaultStore, cfg.Backup)
+	}
+	output.Emit(output.EventRestore, output.RestoreResult{
+		Snapshot: snapshotInfo(snapshot, store),
+		Backup:   safetyInfo,
+		Paths:    restoreOpts.Paths,
+	})
+
+	return nil
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	configPath := getConfigPath()
+	if flagInteractive {
+		return runInitWizard(configPath)
+	}
+
+	// An existing config is upgraded rather than replaced
+	if _, err := os.Stat(configPath); err == nil {
+		return migrateConfig(configPath)
+	}
+
+	if err := os.WriteFile(configPath, []byte(config.GenerateDefault()), 0644); err != nil {
+		return &config.ConfigWriteError{Path: configPath, Cause: err}
+	}
+
+	output.PrintSuccess(false)
+	fmt.Fprintf(output.Stdout, "  Created: %s\n", configPath)
+	return nil
+}
+
+func formatAge(t time.Time) string {
+	duration := time.Since(t)
+	hours := int(duration.Hours())
+
+	if hours < 1 {
+		return "just now"
+	} else if hours < 24 {
+		return fmt.Sprintf("%dh ago", hours)
+	}
+
+	days := hours / 24
+	if days == 1 {
+		return "1d ago"
+	}
+	return fmt.Sprintf("%dd ago", days)
+}
+
+func pluralize(word string, count int) string {
+	if count == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func init() {
+	cobra.OnInitialize(func() {
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			output.DisableColors()
+		}
+	})
+}
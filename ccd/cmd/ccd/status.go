@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/sync"
+)
+
+// Exit codes of ccd status; errors exit with 1.
+const (
+	statusInSync  = 0
+	statusPending = 2
+	statusDrifted = 3
+)
+
+var flagQuiet bool
+
+// exitCodeError makes ccd exit with code without printing an error.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func newStatusCmd(configPath string) *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the target is in sync with the source",
+		Long: fmt.Sprintf(`Compare the source with the target the way a deploy would and print
+one line per mapping: in sync, the number of pending changes, or drifted
+when target files were edited after they were deployed (a deploy would
+overwrite those edits).
+
+Exit status:
+  %d  everything is in sync
+  1  an error occurred
+  %d  changes are pending
+  %d  the target has drifted
+
+Config: %s`, statusInSync, statusPending, statusDrifted, configPath),
+		Args: cobra.NoArgs,
+		RunE: runStatus,
+	}
+	statusCmd.Flags().BoolVar(&flagSync, "sync", false, "Count files a sync deploy would delete as pending")
+	statusCmd.Flags().BoolVarP(&flagQuiet, "quiet", "q", false, "Print nothing, only set the exit status")
+
+	return statusCmd
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	sourceDir := filepath.Join(workDir, cfg.Source)
+	if _, err := os.Stat(sourceDir); err != nil {
+		output.PrintError(fmt.Sprintf("Source directory does not exist: %s", sourceDir))
+		return err
+	}
+
+	statuses, err := sync.Status(sync.SyncOptions{
+		SourceDir:      sourceDir,
+		TargetDir:      targetDir,
+		Mappings:       cfg.Mappings,
+		IgnorePatterns: cfg.IgnorePatterns,
+		SyncMode:       flagSync,
+		DryRun:         true,
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to calculate changes: %v", err))
+		return err
+	}
+
+	code := statusInSync
+	for _, s := range statuses {
+		switch {
+		case len(s.Drifted) > 0:
+			code = statusDrifted
+		case s.Pending > 0 && code == statusInSync:
+			code = statusPending
+		}
+	}
+
+	emitStatus(statuses)
+	if !flagQuiet {
+		printStatuses(statuses)
+	}
+
+	if code == statusInSync {
+		return nil
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return &exitCodeError{code: code}
+}
+
+func printStatuses(statuses []sync.MappingStatus) {
+	width := 0
+	for _, s := range statuses {
+		width = max(width, len(s.Mapping))
+	}
+
+	for _, s := range statuses {
+		var state string
+		switch {
+		case len(s.Drifted) > 0:
+			state = output.Colorize(output.Red, "drifted")
+			if s.Pending > 0 {
+				state += fmt.Sprintf(", %d pending", s.Pending)
+			}
+		case s.Pending > 0:
+			state = output.Colorize(output.Yellow, fmt.Sprintf("%d pending", s.Pending))
+		default:
+			state = output.Colorize(output.Green, "in sync")
+		}
+
+		fmt.Fprintf(output.Stdout, "  %-*s  %s\n", width, s.Mapping, state)
+		for _, path := range s.Drifted {
+			fmt.Fprintf(output.Stdout, "  %-*s    %s\n", width, "", path+" edited in target")
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pt/ccd/internal/backup"
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/output"
+	"github.com/pt/ccd/internal/prompt"
+	"github.com/pt/ccd/internal/sync"
+	"github.com/pt/ccd/internal/watch"
+)
+
+var (
+	flagPoll     bool
+	flagInterval time.Duration
+	flagDebounce time.Duration
+)
+
+func newWatchCmd(configPath string) *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Deploy source changes as they are saved",
+		Long: fmt.Sprintf(`Watch the mapped source paths and deploy the files that change, in
+merge mode, once a burst of saves has settled. Each cycle prints one
+line with what it deployed.
+
+Files removed from the source are only deleted from the target after
+confirming, regardless of --yes. With backups enabled, a snapshot is
+taken before the first change is deployed.
+
+Changes are detected with inotify on Linux and by polling elsewhere,
+or with --poll.
+
+Config: %s`, configPath),
+		Args: cobra.NoArgs,
+		RunE: runWatch,
+	}
+	watchCmd.Flags().BoolVar(&flagPoll, "poll", false, "Poll for changes instead of using inotify")
+	watchCmd.Flags().DurationVar(&flagInterval, "interval", watch.DefaultInterval, "How often to poll for changes")
+	watchCmd.Flags().DurationVar(&flagDebounce, "debounce", watch.DefaultDebounce, "How long a burst of changes must settle before deploying")
+	watchCmd.Flags().StringVar(&flagLabel, "label", "", "Label the backup snapshot (protects it from pruning)")
+
+	return watchCmd
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if flagNoColor {
+		output.DisableColors()
+	}
+
+	cfg, targetDir, err := loadConfig()
+	if err != nil {
+		output.PrintError(err.Error())
+		return err
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to get working directory: %v", err))
+		return err
+	}
+
+	sourceDir := filepath.Join(workDir, cfg.Source)
+	if _, err := os.Stat(sourceDir); err != nil {
+		output.PrintError(fmt.Sprintf("Source directory does not exist: %s", sourceDir))
+		return err
+	}
+	if _, err := os.Stat(targetDir); err != nil {
+		output.PrintError(fmt.Sprintf("Target directory does not exist: %s", targetDir))
+		return err
+	}
+
+	// Without mappings the whole source is deployed
+	var paths []string
+	for _, m := range cfg.Mappings {
+		paths = append(paths, m.Source)
+	}
+
+	output.PrintPaths(sourceDir, targetDir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	session := &watchSession{cfg: cfg, sourceDir: sourceDir, targetDir: targetDir}
+	err = watch.Watch(ctx, watch.Options{
+		Root:     sourceDir,
+		Paths:    paths,
+		Interval: flagInterval,
+		Debounce: flagDebounce,
+		Poll:     flagPoll,
+	}, func(mechanism string) {
+		watched := "the source"
+		if len(paths) > 0 {
+			watched = fmt.Sprintf("%d mapped %s", len(paths), pluralize("path", len(paths)))
+		}
+		output.PrintInfo(fmt.Sprintf("Watching %s (%s), press Ctrl+C to stop", watched, mechanism))
+	}, func(changed []string) {
+		line, err := session.deploy(changed)
+		if err != nil {
+			line = output.Colorize(output.Red, err.Error())
+		}
+		fmt.Fprintf(output.Stdout, "%s %s\n", time.Now().Format("15:04:05"), line)
+	})
+	if err != nil {
+		output.PrintError(fmt.Sprintf("Failed to watch %s: %v", sourceDir, err))
+		return err
+	}
+
+	fmt.Fprintln(output.Stdout)
+	output.PrintInfo("Stopped watching")
+	return nil
+}
+
+// watchSession deploys the source files changed in each watch cycle.
+type watchSession struct {
+	cfg       *config.Config
+	sourceDir string
+	targetDir string
+	backedUp  bool
+}
+
+// deploy applies the changes to the changed source files, asking before
+// deleting the targets of removed ones, and describes them in one line.
+func (s *watchSession) deploy(changed []string) (string, error) {
+	mappingSet, err := sync.ResolveMappings(s.sourceDir, s.targetDir, s.cfg.Mappings)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve mappings: %w", err)
+	}
+
+	selected := make(map[string]bool)
+	for _, relPath := range changed {
+		if targetPath := mappingSet.GetTargetPath(relPath); targetPath != "" {
+			selected[targetPath] = true
+		}
+	}
+
+	opts := sync.SyncOptions{
+		SourceDir:      s.sourceDir,
+		TargetDir:      s.targetDir,
+		Mappings:       s.cfg.Mappings,
+		IgnorePatterns: s.cfg.IgnorePatterns,
+		SyncMode:       true,
+		DryRun:         true,
+		Select:         selected,
+	}
+	plan, err := sync.Sync(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate changes: %w", err)
+	}
+
+	kept := 0
+	if deletions := sync.GetDeletions(plan.Changes); len(deletions) > 0 {
+		if !prompt.ConfirmDeletes(deletions, false) {
+			for _, d := range deletions {
+				if !d.IsDir {
+					kept++
+				}
+			}
+			opts.SyncMode = false
+			if plan, err = sync.Sync(opts); err != nil {
+				return "", fmt.Errorf("failed to calculate changes: %w", err)
+			}
+		}
+	}
+
+	emitPlan(plan.Changes)
+
+	var notes []string
+	if kept > 0 {
+		notes = append(notes, fmt.Sprintf("kept %d %s removed from the source", kept, pluralize("file", kept)))
+	}
+
+	if !plan.Summary.HasChanges() {
+		return strings.Join(append([]string{"no changes"}, notes...), ", "), nil
+	}
+
+	if s.cfg.Backup.Enabled && !s.backedUp {
+		note, err := s.snapshot(plan.Summary)
+		if err != nil {
+			output.PrintWarning(fmt.Sprintf("Failed to create backup: %v", err))
+		} else {
+			notes = append(notes, note)
+		}
+		// One snapshot covers the whole session
+		s.backedUp = true
+	}
+
+	opts.DryRun = false
+	if _, err := sync.Sync(opts); err != nil {
+		return "", fmt.Errorf("failed to sync: %w", err)
+	}
+
+	line := fmt.Sprintf("%s %s %s %s",
+		output.Colorize(output.Green, fmt.Sprintf("+%d", plan.Summary.Created)),
+		output.Colorize(output.Yellow, fmt.Sprintf("~%d", plan.Summary.Updated)),
+		output.Colorize(output.Red, fmt.Sprintf("-%d", plan.Summary.Deleted)),
+		describeChangedFiles(plan.Changes))
+	if len(notes) > 0 {
+		line += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return line, nil
+}
+
+// snapshot backs up the mapped target paths before the first deploy of
+// the session and prunes old snapshots.
+func (s *watchSession) snapshot(summary output.Summary) (string, error) {
+	metadata := snapshotMetadata(backup.ReasonDeploy, s.sourceDir)
+	metadata.Label = flagLabel
+	metadata.Mode = "merge"
+	metadata.Changes = &backup.ChangeSummary{
+		Created: summary.Created,
+		Updated: summary.Updated,
+		Deleted: summary.Deleted,
+	}
+
+	store, err := openStore(s.cfg.Backup, "", s.targetDir)
+	if err != nil {
+		return "", err
+	}
+	snapshot, err := backup.CreateSnapshot(backup.SnapshotOptions{
+		TargetDir:   s.targetDir,
+		Store:       store,
+		Mappings:    s.cfg.Mappings,
+		ExtraPaths:  s.cfg.Backup.ExtraPaths,
+		Metadata:    metadata,
+		Encryption:  snapshotEncryption(s.cfg.Backup, snapshotKeys(s.cfg.Backup)),
+		Compression: snapshotCompression(s.cfg.Backup),
+	})
+	if err != nil {
+		return "", err
+	}
+	output.Emit(output.EventBackup, snapshotInfo(snapshot, store))
+
+	pruned, err := pruneSnapshots(store, s.cfg.Backup)
+	if err != nil {
+		output.PrintWarning(fmt.Sprintf("Failed to prune old backups: %v", err))
+	} else {
+		output.Emit(output.EventPrune, output.PruneResult{Removed: nonNil(pruned)})
+	}
+
+	return "backup " + snapshot.Name, nil
+}
+
+// describeChangedFiles lists the first few changed files by path.
+func describeChangedFiles(changes []output.FileChange) string {
+	const shown = 3
+
+	var paths []string
+	for _, c := range changes {
+		if !c.IsDir {
+			paths = append(paths, c.Path)
+		}
+	}
+	sort.Strings(paths)
+
+	if len(paths) > shown {
+		return fmt.Sprintf("%s and %d more", strings.Join(paths[:shown], ", "), len(paths)-shown)
+	}
+	return strings.Join(paths, ", ")
+}
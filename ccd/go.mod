@@ -1,13 +1,17 @@
 module github.com/pt/ccd
 
-go 1.21
+go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.33.0
+	golang.org/x/term v0.29.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Entry is a single file or directory stored in a snapshot archive.
+type Entry struct {
+	Path    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+
+	open func() (io.ReadCloser, error)
+}
+
+// Open returns a reader for the entry's content.
+func (e *Entry) Open() (io.ReadCloser, error) {
+	return e.open()
+}
+
+// Archive provides read access to the contents of a snapshot file.
+type Archive struct {
+	// Manifest is nil for legacy snapshots created without one.
+	Manifest *BackupManifest
+	Entries  []Entry
+
+	closer io.Closer
+}
+
+// newArchive reads the snapshot stored in obj and its manifest, if present.
+// The format is detected from the content. The archive takes ownership of
+// obj.
+func newArchive(obj Object) (*Archive, error) {
+	format, err := detectFormat(obj)
+	if err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	if format != FormatZip {
+		return newTarArchive(obj, format)
+	}
+
+	reader, err := zip.NewReader(obj, obj.Size())
+	if err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	archive := &Archive{closer: obj}
+
+	for _, file := range reader.File {
+		if file.Name == ManifestFilename {
+			manifest, err := readManifest(file)
+			if err != nil {
+				obj.Close()
+				return nil, err
+			}
+			archive.Manifest = manifest
+			continue
+		}
+
+		info := file.FileInfo()
+		archive.Entries = append(archive.Entries, Entry{
+			Path:    strings.TrimSuffix(file.Name, "/"),
+			Size:    info.Size(),
+			Mode:    file.Mode(),
+			ModTime: file.Modified,
+			IsDir:   info.IsDir(),
+			open:    file.Open,
+		})
+	}
+
+	return archive, nil
+}
+
+// newTarArchive decompresses a tar snapshot, spooling file contents to a
+// temporary file so entries can be opened in any order. Reading the whole
+// stream up front verifies its checksum before anything is restored.
+func newTarArchive(obj Object, format Format) (*Archive, error) {
+	defer obj.Close()
+
+	spool, err := os.CreateTemp("", "ccd-snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	archive := &Archive{closer: tempFile{spool}}
+
+	if err := archive.readTar(io.NewSectionReader(obj, 0, obj.Size()), format, spool); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return archive, nil
+}
+
+func (a *Archive) readTar(r io.Reader, format Format, spool *os.File) error {
+	stream, err := newDecompressor(r, format)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	var offset int64
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(header.Name, "/")
+		if name == ManifestFilename {
+			if a.Manifest, err = parseManifestFrom(tr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info := header.FileInfo()
+		entry := Entry{
+			Path:    name,
+			Size:    header.Size,
+			Mode:    info.Mode(),
+			ModTime: header.ModTime,
+			IsDir:   info.IsDir(),
+		}
+		if header.Typeflag == tar.TypeReg {
+			n, err := io.Copy(spool, tr)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			section := io.NewSectionReader(spool, offset, n)
+			entry.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(section, 0, section.Size())), nil
+			}
+			offset += n
+		} else if !entry.IsDir {
+			continue
+		}
+		a.Entries = append(a.Entries, entry)
+	}
+
+	// Read to the end of the compressed stream so its checksum is checked
+	_, err = io.Copy(io.Discard, stream)
+	return err
+}
+
+// tempFile is a temporary file removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// peekManifest reads just the manifest of a snapshot, which tar snapshots
+// store as their first entry. It returns nil for snapshots without one.
+func peekManifest(obj Object) (*BackupManifest, error) {
+	format, err := detectFormat(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatZip {
+		reader, err := zip.NewReader(obj, obj.Size())
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			if file.Name == ManifestFilename {
+				return readManifest(file)
+			}
+		}
+		return nil, nil
+	}
+
+	stream, err := newDecompressor(io.NewSectionReader(obj, 0, obj.Size()), format)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	tr := tar.NewReader(stream)
+	header, err := tr.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != ManifestFilename {
+		return nil, nil
+	}
+	return parseManifestFrom(tr)
+}
+
+// Close releases the underlying snapshot file.
+func (a *Archive) Close() error {
+	return a.closer.Close()
+}
+
+// Verify reads every file in the archive, checking its checksum and that
+// the files match those listed in the manifest. It returns the number of
+// files verified.
+func (a *Archive) Verify() (int, error) {
+	files := 0
+	for i := range a.Entries {
+		entry := &a.Entries[i]
+		if entry.IsDir {
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return files, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		n, err := io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return files, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		if n != entry.Size {
+			return files, fmt.Errorf("%s: size mismatch: expected %d bytes, read %d", entry.Path, entry.Size, n)
+		}
+		files++
+	}
+
+	if a.Manifest == nil {
+		return files, nil
+	}
+
+	stored := a.Files()
+	for _, f := range a.Manifest.Files {
+		entry, ok := stored[f.Path]
+		if !ok {
+			return files, fmt.Errorf("%s: listed in manifest but missing from snapshot", f.Path)
+		}
+		if entry.Size != f.Size {
+			return files, fmt.Errorf("%s: size %d does not match manifest (%d)", f.Path, entry.Size, f.Size)
+		}
+	}
+	if len(stored) != len(a.Manifest.Files) {
+		return files, fmt.Errorf("snapshot holds %d files but manifest lists %d", len(stored), len(a.Manifest.Files))
+	}
+
+	return files, nil
+}
+
+func readManifest(file *zip.File) (*BackupManifest, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer rc.Close()
+
+	return parseManifestFrom(rc)
+}
+
+func parseManifestFrom(r io.Reader) (*BackupManifest, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
@@ -1,7 +1,8 @@
 package backup
 
 import (
-	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -16,322 +17,484 @@ import (
 const (
 	TimestampFormat = "2006-01-02_15-04-05"
 	SnapshotPrefix  = "backup_"
-	SnapshotSuffix  = ".zip"
+	// SnapshotSuffix is the extension of zip snapshots, the default
+	// format and the only one before backup.format was added.
+	SnapshotSuffix = ".zip"
 )
 
 type Snapshot struct {
-	Path      string
 	Name      string
 	Timestamp time.Time
 	Size      int64
+
+	// Metadata is read from the manifest, or from the public header of an
+	// encrypted snapshot; zero for legacy snapshots.
+	Metadata  Metadata
+	Encrypted bool
+	// TargetDir is the target the snapshot was taken of; empty for legacy
+	// snapshots without a manifest.
+	TargetDir string
+	// Commit identifies the snapshot in a GitStore's history.
+	Commit string
+
+	store Store
 }
 
-func CreateSnapshot(targetDir, backupDir string, mappings []config.Mapping) (*Snapshot, error) {
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+// Open opens the snapshot's archive from its store. keys is only needed
+// for encrypted snapshots.
+func (s *Snapshot) Open(keys *Keys) (*Archive, error) {
+	obj, err := s.store.Open(s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
 	}
 
-	timestamp := time.Now()
-	name := SnapshotPrefix + timestamp.Format(TimestampFormat) + SnapshotSuffix
-	zipPath := filepath.Join(backupDir, name)
-
-	zipFile, err := os.Create(zipPath)
+	header, aad, err := readEncryptionHeader(obj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create zip file: %w", err)
+		obj.Close()
+		return nil, err
+	}
+	if header != nil {
+		plain, err := decryptSnapshot(obj, header, aad, keys)
+		obj.Close()
+		if err != nil {
+			return nil, err
+		}
+		obj = plain
 	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
 
-	manifest := NewManifest(timestamp, targetDir)
+	return newArchive(obj)
+}
 
-	// Determine which paths to backup
-	var pathsToBackup []string
-	if len(mappings) > 0 {
-		// Scoped backup: only mapped target paths
-		for _, m := range mappings {
-			targetPath := filepath.Join(targetDir, m.Target)
-			if _, err := os.Stat(targetPath); err == nil {
-				pathsToBackup = append(pathsToBackup, m.Target)
-			}
-		}
-	} else {
-		// Legacy: backup everything
-		pathsToBackup = []string{""}
+// readMetadata fills in the snapshot metadata without decrypting it.
+func (s *Snapshot) readMetadata() {
+	obj, err := s.store.Open(s.Name)
+	if err != nil {
+		return
+	}
+	defer obj.Close()
+
+	if header, _, err := readEncryptionHeader(obj); err != nil {
+		return
+	} else if header != nil {
+		s.Encrypted = true
+		s.Metadata = header.Metadata
+		s.TargetDir = header.TargetDir
+		s.refineTimestamp(header.Timestamp)
+		return
 	}
 
-	for _, basePath := range pathsToBackup {
-		walkRoot := filepath.Join(targetDir, basePath)
+	if manifest, err := peekManifest(obj); err == nil && manifest != nil {
+		s.Metadata = manifest.Metadata
+		s.TargetDir = manifest.TargetDir
+		s.refineTimestamp(manifest.Timestamp)
+	}
+}
 
-		err = filepath.Walk(walkRoot, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+// refineTimestamp replaces the second-resolution timestamp from the name
+// with the precise one recorded in the snapshot, which orders snapshots
+// taken within the same second.
+func (s *Snapshot) refineTimestamp(recorded time.Time) {
+	if recorded.Truncate(time.Second).Equal(s.Timestamp) {
+		s.Timestamp = recorded
+	}
+}
 
-			relPath, err := filepath.Rel(targetDir, path)
-			if err != nil {
-				return err
-			}
+// Delete removes the snapshot from its store.
+func (s *Snapshot) Delete() error {
+	return s.store.Delete(s.Name)
+}
 
-			if relPath == "." {
-				return nil
-			}
+// SnapshotOptions describes what a snapshot covers and why it is taken.
+type SnapshotOptions struct {
+	TargetDir string
+	Store     Store
+	Mappings  []config.Mapping
+	// ExtraPaths are unmapped target paths captured alongside mapped
+	// content, either relative to TargetDir or absolute within it.
+	ExtraPaths []string
+	Metadata   Metadata
+	// Encryption encrypts the snapshot when set.
+	Encryption *Keys
+	// Compression selects the archive format and compression level.
+	Compression Compression
+}
 
-			header, err := zip.FileInfoHeader(info)
-			if err != nil {
-				return err
-			}
+func CreateSnapshot(opts SnapshotOptions) (*Snapshot, error) {
+	targetDir, mappings := opts.TargetDir, opts.Mappings
 
-			header.Name = relPath
-			if info.IsDir() {
-				header.Name += "/"
-			} else {
-				header.Method = zip.Deflate
-				manifest.AddFile(relPath, info.Size())
-			}
+	extraPaths, err := ResolveExtraPaths(targetDir, opts.ExtraPaths, mappings)
+	if err != nil {
+		return nil, err
+	}
 
-			writer, err := zipWriter.CreateHeader(header)
-			if err != nil {
-				return err
-			}
+	if err := opts.Compression.Validate(); err != nil {
+		return nil, err
+	}
 
-			if !info.IsDir() {
-				file, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
-				_, err = io.Copy(writer, file)
-				if err != nil {
-					return err
-				}
-			}
+	// A git store commits the archive's files, so its snapshots are not
+	// named after the archive format
+	timestamp := time.Now()
+	format := opts.Compression.format()
+	if AppendOnly(opts.Store) {
+		format = ""
+	}
+	name, err := newSnapshotName(timestamp, format)
+	if err != nil {
+		return nil, err
+	}
 
-			return nil
-		})
+	manifest := NewManifest(timestamp, absTarget(targetDir))
+	manifest.Metadata = opts.Metadata
+	manifest.Roots = mappedRoots(mappings)
+	manifest.ExtraPaths = extraPaths
 
-		if err != nil {
-			os.Remove(zipPath)
-			return nil, fmt.Errorf("failed to create backup: %w", err)
+	files, err := collectFiles(targetDir, append(backupRoots(targetDir, mappings), existingPaths(targetDir, extraPaths)...), opts.Compression.format())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	for _, f := range files {
+		if !f.info.IsDir() {
+			manifest.AddFile(f.relPath, f.info.Size())
 		}
 	}
 
-	// Write manifest.json to zip
 	manifestData, err := manifest.ToJSON()
 	if err != nil {
-		os.Remove(zipPath)
 		return nil, fmt.Errorf("failed to create manifest: %w", err)
 	}
 
-	manifestWriter, err := zipWriter.Create(ManifestFilename)
+	// Build the archive locally and hand it to the store once complete
+	archiveFile, err := os.CreateTemp("", "ccd-snapshot-*")
 	if err != nil {
-		os.Remove(zipPath)
-		return nil, fmt.Errorf("failed to write manifest: %w", err)
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(archiveFile.Name())
+	defer archiveFile.Close()
+
+	writer, err := newArchiveWriter(archiveFile, opts.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
 	}
-	if _, err := manifestWriter.Write(manifestData); err != nil {
-		os.Remove(zipPath)
+
+	// The manifest goes first so that it can be read without
+	// decompressing the rest of a tar snapshot
+	if err := writer.AddBytes(ManifestFilename, manifestData); err != nil {
+		writer.Close()
 		return nil, fmt.Errorf("failed to write manifest: %w", err)
 	}
+	for _, f := range files {
+		if err := writer.Add(f.relPath, f.path, f.info); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("failed to create backup: %w", err)
+		}
+	}
 
-	// Close zip to flush
-	if err := zipWriter.Close(); err != nil {
-		os.Remove(zipPath)
+	if err := writer.Close(); err != nil {
 		return nil, fmt.Errorf("failed to finalize backup: %w", err)
 	}
 
-	info, _ := os.Stat(zipPath)
+	snapshotFile := archiveFile
+	if opts.Encryption != nil {
+		encrypted, err := encryptFile(archiveFile, opts.Encryption, manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+		defer os.Remove(encrypted.Name())
+		defer encrypted.Close()
+		snapshotFile = encrypted
+	}
+
+	size, err := snapshotFile.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = snapshotFile.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = opts.Store.Put(name, snapshotFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store backup: %w", err)
+	}
 
 	return &Snapshot{
-		Path:      zipPath,
 		Name:      name,
 		Timestamp: timestamp,
-		Size:      info.Size(),
+		Size:      size,
+		Metadata:  opts.Metadata,
+		Encrypted: opts.Encryption != nil,
+		TargetDir: manifest.TargetDir,
+		store:     opts.Store,
 	}, nil
 }
 
-func ListSnapshots(backupDir string) ([]Snapshot, error) {
-	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-		return nil, nil
-	}
-
-	entries, err := os.ReadDir(backupDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read backup directory: %w", err)
-	}
-
-	var snapshots []Snapshot
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
+// snapshotFile is a target path to be stored in a snapshot.
+type snapshotFile struct {
+	relPath string
+	path    string
+	info    os.FileInfo
+}
 
-		name := entry.Name()
-		if !strings.HasPrefix(name, SnapshotPrefix) || !strings.HasSuffix(name, SnapshotSuffix) {
-			continue
-		}
+// collectFiles walks the given target-relative roots. Tar formats only
+// store regular files and directories, so other file types are left out.
+func collectFiles(targetDir string, roots []string, format Format) ([]snapshotFile, error) {
+	var files []snapshotFile
+	for _, root := range roots {
+		err := filepath.Walk(filepath.Join(targetDir, root), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-		timestampStr := strings.TrimPrefix(name, SnapshotPrefix)
-		timestampStr = strings.TrimSuffix(timestampStr, SnapshotSuffix)
+			relPath, err := filepath.Rel(targetDir, path)
+			if err != nil {
+				return err
+			}
+			if relPath == "." {
+				return nil
+			}
+			if format != FormatZip && !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
 
-		timestamp, err := time.Parse(TimestampFormat, timestampStr)
+			files = append(files, snapshotFile{relPath: relPath, path: path, info: info})
+			return nil
+		})
 		if err != nil {
-			continue
+			return nil, err
 		}
+	}
+	return files, nil
+}
 
-		info, err := entry.Info()
-		if err != nil {
-			continue
+// newSnapshotName names a snapshot after its timestamp plus a random ID, so
+// snapshots taken within the same second do not collide. The extension is
+// informational; the format is detected from the content when reading. An
+// empty format leaves it out.
+func newSnapshotName(timestamp time.Time, format Format) (string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate snapshot id: %w", err)
+	}
+	name := SnapshotPrefix + timestamp.Format(TimestampFormat) + "_" + hex.EncodeToString(id)
+	if format != "" {
+		name += "." + string(format)
+	}
+	return name, nil
+}
+
+// parseSnapshotName returns the timestamp of a snapshot name. Names from
+// before snapshot IDs have no "_<id>" after the timestamp, and those of
+// git stores no extension.
+func parseSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, SnapshotPrefix) {
+		return time.Time{}, false
+	}
+	stem := ""
+	if !strings.Contains(name, ".") {
+		stem = strings.TrimPrefix(name, SnapshotPrefix)
+	}
+	for _, format := range formats {
+		if suffix := "." + string(format); strings.HasSuffix(name, suffix) {
+			stem = strings.TrimSuffix(strings.TrimPrefix(name, SnapshotPrefix), suffix)
+			break
 		}
+	}
+	if len(stem) < len(TimestampFormat) {
+		return time.Time{}, false
+	}
+	if id := stem[len(TimestampFormat):]; id != "" && !strings.HasPrefix(id, "_") {
+		return time.Time{}, false
+	}
 
-		snapshots = append(snapshots, Snapshot{
-			Path:      filepath.Join(backupDir, name),
-			Name:      name,
-			Timestamp: timestamp,
-			Size:      info.Size(),
-		})
+	timestamp, err := time.ParseInLocation(TimestampFormat, stem[:len(TimestampFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, false
 	}
+	return timestamp, true
+}
 
-	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].Timestamp.After(snapshots[j].Timestamp)
-	})
+// encryptFile writes the encrypted form of the finished archive to a new
+// temporary file.
+func encryptFile(archiveFile *os.File, keys *Keys, manifest *BackupManifest) (*os.File, error) {
+	header, key, err := keys.newHeader()
+	if err != nil {
+		return nil, err
+	}
+	header.Timestamp = manifest.Timestamp
+	header.TargetDir = manifest.TargetDir
+	header.Metadata = manifest.Metadata
 
-	return snapshots, nil
-}
+	if _, err := archiveFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 
-func RestoreSnapshot(snapshotPath, targetDir string) error {
-	reader, err := zip.OpenReader(snapshotPath)
+	encrypted, err := os.CreateTemp("", "ccd-snapshot-*.enc")
 	if err != nil {
-		return fmt.Errorf("failed to open snapshot: %w", err)
+		return nil, err
+	}
+	if err := encryptSnapshot(encrypted, archiveFile, header, key); err != nil {
+		encrypted.Close()
+		os.Remove(encrypted.Name())
+		return nil, err
 	}
-	defer reader.Close()
+	return encrypted, nil
+}
 
-	// Check for manifest
-	var manifest *BackupManifest
-	for _, file := range reader.File {
-		if file.Name == ManifestFilename {
-			rc, err := file.Open()
-			if err != nil {
-				return fmt.Errorf("failed to read manifest: %w", err)
-			}
-			data, err := io.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				return fmt.Errorf("failed to read manifest: %w", err)
-			}
-			manifest, err = ParseManifest(data)
-			if err != nil {
-				return fmt.Errorf("failed to parse manifest: %w", err)
-			}
-			break
-		}
+// backupRoots returns the target-relative paths a snapshot covers: the
+// existing mapped targets, or the whole target when there are no mappings.
+func backupRoots(targetDir string, mappings []config.Mapping) []string {
+	if len(mappings) == 0 {
+		// Legacy: backup everything
+		return []string{""}
 	}
 
-	if manifest != nil {
-		// Scoped restore: only restore files listed in manifest
-		// First, delete existing files that are in the manifest
-		for _, entry := range manifest.Files {
-			destPath := filepath.Join(targetDir, entry.Path)
-			os.Remove(destPath) // Ignore error if doesn't exist
-		}
-	} else {
-		// Legacy restore: nuke everything
-		if err := os.RemoveAll(targetDir); err != nil {
-			return fmt.Errorf("failed to clear target directory: %w", err)
-		}
-		if err := os.MkdirAll(targetDir, 0755); err != nil {
-			return fmt.Errorf("failed to create target directory: %w", err)
-		}
+	// Scoped backup: only mapped target paths
+	var targets []string
+	for _, m := range mappings {
+		targets = append(targets, m.Target)
 	}
+	return existingPaths(targetDir, targets)
+}
 
-	for _, file := range reader.File {
-		// Skip manifest file
-		if file.Name == ManifestFilename {
-			continue
-		}
+// mappedRoots returns the target-relative paths covered by the mappings,
+// or "." for the whole target when there are none.
+func mappedRoots(mappings []config.Mapping) []string {
+	if len(mappings) == 0 {
+		return []string{"."}
+	}
 
-		destPath := filepath.Join(targetDir, file.Name)
+	roots := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		roots = append(roots, filepath.Clean(m.Target))
+	}
+	return roots
+}
 
-		if !strings.HasPrefix(destPath, filepath.Clean(targetDir)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path in archive: %s", file.Name)
+func existingPaths(targetDir string, relPaths []string) []string {
+	var existing []string
+	for _, p := range relPaths {
+		if _, err := os.Stat(filepath.Join(targetDir, p)); err == nil {
+			existing = append(existing, p)
 		}
+	}
+	return existing
+}
 
-		if file.FileInfo().IsDir() {
-			if err := os.MkdirAll(destPath, file.Mode()); err != nil {
-				return err
-			}
-			continue
-		}
+// ResolveExtraPaths converts configured extra paths to target-relative
+// form. Paths already covered by a mapping (or by a whole-target legacy
+// backup) are dropped, so the result lists only unmapped content.
+func ResolveExtraPaths(targetDir string, extraPaths []string, mappings []config.Mapping) ([]string, error) {
+	if len(extraPaths) == 0 || len(mappings) == 0 {
+		return nil, nil
+	}
 
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			return err
-		}
+	absTarget, err := filepath.Abs(targetDir)
+	if err != nil {
+		return nil, err
+	}
 
-		destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return err
-		}
+	var mapped []string
+	for _, m := range mappings {
+		mapped = append(mapped, filepath.Clean(m.Target))
+	}
 
-		srcFile, err := file.Open()
-		if err != nil {
-			destFile.Close()
-			return err
+	var resolved []string
+	for _, p := range extraPaths {
+		relPath := config.ExpandPath(p)
+		if filepath.IsAbs(relPath) {
+			if relPath, err = filepath.Rel(absTarget, relPath); err != nil {
+				return nil, fmt.Errorf("invalid extra path %s: %w", p, err)
+			}
 		}
+		relPath = filepath.Clean(relPath)
 
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
-		destFile.Close()
-
-		if err != nil {
-			return err
+		if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("extra path %s must be inside the target directory %s", p, targetDir)
 		}
+		if isUnder(mapped, relPath) || isUnder(resolved, relPath) {
+			continue
+		}
+		resolved = append(resolved, relPath)
 	}
 
-	return nil
+	return resolved, nil
 }
 
-func PruneSnapshots(backupDir string, maxSnapshots int) ([]string, error) {
-	snapshots, err := ListSnapshots(backupDir)
+// ListSnapshots returns the snapshots in the store, newest first.
+func ListSnapshots(store Store) ([]Snapshot, error) {
+	objects, err := store.List()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(snapshots) <= maxSnapshots {
-		return nil, nil
-	}
+	var snapshots []Snapshot
+	for _, obj := range objects {
+		name := obj.Name
+		timestamp, ok := parseSnapshotName(name)
+		if !ok {
+			continue
+		}
 
-	var pruned []string
-	for i := maxSnapshots; i < len(snapshots); i++ {
-		if err := os.Remove(snapshots[i].Path); err != nil {
-			return pruned, fmt.Errorf("failed to remove %s: %w", snapshots[i].Name, err)
+		snapshot := Snapshot{
+			Name:      name,
+			Timestamp: timestamp,
+			Size:      obj.Size,
+			Commit:    obj.Commit,
+			store:     store,
+		}
+		if m := obj.Manifest; m != nil {
+			snapshot.Metadata = m.Metadata
+			snapshot.TargetDir = m.TargetDir
+			snapshot.refineTimestamp(m.Timestamp)
+		} else {
+			snapshot.readMetadata()
 		}
-		pruned = append(pruned, snapshots[i].Name)
+
+		snapshots = append(snapshots, snapshot)
 	}
 
-	return pruned, nil
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.After(snapshots[j].Timestamp)
+	})
+
+	return snapshots, nil
 }
 
-func FindSnapshot(backupDir, identifier string) (*Snapshot, error) {
-	snapshots, err := ListSnapshots(backupDir)
-	if err != nil {
-		return nil, err
-	}
+// SnapshotFilter selects snapshots by their metadata. Empty fields match
+// any snapshot.
+type SnapshotFilter struct {
+	Reason string
+	Label  string
+	// Before only matches snapshots taken earlier than this time.
+	Before time.Time
+}
 
-	if len(snapshots) == 0 {
-		return nil, fmt.Errorf("no snapshots found")
+// Match reports whether the snapshot satisfies the filter.
+func (f SnapshotFilter) Match(s Snapshot) bool {
+	if f.Reason != "" && s.Metadata.Reason != f.Reason {
+		return false
 	}
+	if f.Label != "" && s.Metadata.Label != f.Label {
+		return false
+	}
+	if !f.Before.IsZero() && !s.Timestamp.Before(f.Before) {
+		return false
+	}
+	return true
+}
 
-	if identifier == "" {
-		return &snapshots[0], nil
+// LatestSnapshot returns the newest snapshot matching the filter.
+func LatestSnapshot(store Store, filter SnapshotFilter) (*Snapshot, error) {
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, s := range snapshots {
-		if strings.Contains(s.Name, identifier) {
+		if filter.Match(s) {
 			return &s, nil
 		}
 	}
 
-	return nil, fmt.Errorf("snapshot not found: %s", identifier)
+	return nil, fmt.Errorf("no matching snapshots found")
 }
 
 func FormatSize(bytes int64) string {
@@ -0,0 +1,358 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func TestRestoreSnapshot_Paths_RestoresOnlyMatched(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original claude")
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "original tdd")
+	writeFile(t, targetDir, "skills/qa/SKILL.md", "original qa")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir: targetDir,
+		Store:     NewLocalStore(backupDir),
+		Mappings: []config.Mapping{
+			{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+			{Source: "skills", Target: "skills"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "deployed claude")
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "deployed tdd")
+	writeFile(t, targetDir, "skills/qa/SKILL.md", "deployed qa")
+
+	err = RestoreSnapshot(snapshot, targetDir, RestoreOptions{Paths: []string{"skills/tdd"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContent(t, targetDir, "skills/tdd/SKILL.md", "original tdd")
+	assertContent(t, targetDir, "skills/qa/SKILL.md", "deployed qa")
+	assertContent(t, targetDir, "CLAUDE.md", "deployed claude")
+}
+
+func TestRestoreSnapshot_Paths_LegacyDoesNotClearTarget(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "changed")
+	writeFile(t, targetDir, "projects/data.md", "user data")
+
+	err = RestoreSnapshot(snapshot, targetDir, RestoreOptions{Paths: []string{"CLAUDE.md"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+	assertContent(t, targetDir, "projects/data.md", "user data")
+}
+
+func TestPlanRestore_Paths_Globs(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+	writeFile(t, targetDir, "skills/qa/SKILL.md", "qa")
+	writeFile(t, targetDir, "skills/coder/SKILL.md", "coder")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir: targetDir,
+		Store:     NewLocalStore(backupDir),
+		Mappings:  []config.Mapping{{Source: "skills", Target: "skills"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	os.RemoveAll(filepath.Join(targetDir, "skills/tdd"))
+
+	plan, err := PlanRestore(snapshot, targetDir, RestoreOptions{Paths: []string{"skills/t*", "skills/qa/"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ops := make(map[string]string)
+	for _, c := range plan.Changes {
+		ops[c.Path] = c.Operation
+	}
+
+	if len(ops) != 2 {
+		t.Fatalf("expected 2 planned changes, got %v", ops)
+	}
+	if ops[filepath.Join("skills", "tdd", "SKILL.md")] != "create" {
+		t.Errorf("expected skills/tdd/SKILL.md to be created, got %v", ops)
+	}
+	if ops[filepath.Join("skills", "qa", "SKILL.md")] != "update" {
+		t.Errorf("expected skills/qa/SKILL.md to be updated, got %v", ops)
+	}
+}
+
+func TestRestoreSnapshot_ExtraPathsAreOptIn(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+	writeFile(t, targetDir, "settings.json", "original settings")
+	writeFile(t, targetDir, "projects/memory.md", "original memory")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:  targetDir,
+		Store:      NewLocalStore(backupDir),
+		Mappings:   []config.Mapping{{Source: "CLAUDE.md", Target: "CLAUDE.md"}},
+		ExtraPaths: []string{"settings.json", filepath.Join(targetDir, "projects")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "changed")
+	writeFile(t, targetDir, "settings.json", "changed settings")
+	writeFile(t, targetDir, "projects/memory.md", "changed memory")
+
+	plan, err := PlanRestore(snapshot, targetDir, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 1 || plan.SkippedExtra != 2 {
+		t.Errorf("expected 1 change and 2 skipped extras, got %d and %d", len(plan.Changes), plan.SkippedExtra)
+	}
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+	assertContent(t, targetDir, "settings.json", "changed settings")
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{IncludeExtra: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "settings.json", "original settings")
+	assertContent(t, targetDir, "projects/memory.md", "original memory")
+}
+
+func TestResolveExtraPaths(t *testing.T) {
+	targetDir := t.TempDir()
+	mappings := []config.Mapping{{Source: "skills/", Target: "skills/"}}
+
+	resolved, err := ResolveExtraPaths(targetDir, []string{
+		filepath.Join(targetDir, "settings.json"),
+		"projects/",
+		"skills/tdd",
+		"projects/nested",
+	}, mappings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(resolved) != 2 || resolved[0] != "settings.json" || resolved[1] != "projects" {
+		t.Errorf("expected [settings.json projects], got %v", resolved)
+	}
+
+	if _, err := ResolveExtraPaths(targetDir, []string{"../outside"}, mappings); err == nil {
+		t.Error("expected error for path outside the target")
+	}
+}
+
+func TestCompare_SnapshotAgainstCurrent(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	mappings := []config.Mapping{{Source: "skills", Target: "skills"}}
+
+	writeFile(t, targetDir, "skills/kept.md", "same")
+	writeFile(t, targetDir, "skills/changed.md", "aaaa")
+	writeFile(t, targetDir, "skills/removed.md", "gone")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Mappings: mappings})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "skills/changed.md", "bbbb")
+	writeFile(t, targetDir, "skills/added.md", "new")
+	os.Remove(filepath.Join(targetDir, "skills/removed.md"))
+
+	archive, err := snapshot.Open(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer archive.Close()
+
+	current, err := ScanTarget(targetDir, mappings, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changes, err := Compare(archive, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ops := make(map[string]string)
+	for _, c := range changes {
+		ops[c.Path] = c.Operation
+	}
+
+	want := map[string]string{
+		filepath.Join("skills", "added.md"):   "create",
+		filepath.Join("skills", "changed.md"): "update",
+		filepath.Join("skills", "removed.md"): "delete",
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("expected %v, got %v", want, ops)
+	}
+	for path, op := range want {
+		if ops[path] != op {
+			t.Errorf("expected %s to be %s, got %q", path, op, ops[path])
+		}
+	}
+}
+
+func TestListSnapshots_ReadsMetadata(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "content")
+
+	metadata := Metadata{
+		Reason:     ReasonDeploy,
+		Label:      "stable",
+		Mode:       "sync",
+		CCDVersion: "1.2.3",
+		Source:     &SourceInfo{Commit: "abc123", Dirty: true},
+		Changes:    &ChangeSummary{Created: 1, Updated: 2},
+	}
+
+	_, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Metadata: metadata})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(NewLocalStore(backupDir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snapshots))
+	}
+
+	got := snapshots[0].Metadata
+	if got.Reason != ReasonDeploy || got.Label != "stable" || got.Mode != "sync" || got.CCDVersion != "1.2.3" {
+		t.Errorf("unexpected metadata: %+v", got)
+	}
+	if got.Source == nil || got.Source.Commit != "abc123" || !got.Source.Dirty {
+		t.Errorf("unexpected source info: %+v", got.Source)
+	}
+	if got.Changes == nil || got.Changes.Updated != 2 {
+		t.Errorf("unexpected change summary: %+v", got.Changes)
+	}
+
+	if !(SnapshotFilter{Label: "stable"}).Match(snapshots[0]) {
+		t.Error("expected label filter to match")
+	}
+	if (SnapshotFilter{Reason: ReasonManual}).Match(snapshots[0]) {
+		t.Error("expected reason filter to not match")
+	}
+}
+
+func TestLatestSnapshot_FindsPreRollbackSnapshot(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "content")
+
+	_, err := CreateSnapshot(SnapshotOptions{
+		TargetDir: targetDir,
+		Store:     NewLocalStore(backupDir),
+		Metadata: Metadata{
+			Reason:   ReasonRollback,
+			Rollback: &RollbackInfo{From: "backup_x.zip", Paths: []string{"skills"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshot, err := LatestSnapshot(NewLocalStore(backupDir), SnapshotFilter{Reason: ReasonRollback})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Metadata.Rollback == nil || snapshot.Metadata.Rollback.From != "backup_x.zip" {
+		t.Errorf("expected rollback info to round-trip, got %+v", snapshot.Metadata.Rollback)
+	}
+
+	if _, err := LatestSnapshot(NewLocalStore(backupDir), SnapshotFilter{Reason: ReasonManual}); err == nil {
+		t.Error("expected error when no snapshot matches")
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{nil, "anything", true},
+		{[]string{"CLAUDE.md"}, "CLAUDE.md", true},
+		{[]string{"skills/tdd"}, "skills/tdd/SKILL.md", true},
+		{[]string{"skills/tdd/"}, "skills/tdd/assets/TEMPLATE.md", true},
+		{[]string{"skills/tdd"}, "skills/tdd-extra/SKILL.md", false},
+		{[]string{"skills/*/SKILL.md"}, "skills/qa/SKILL.md", true},
+		{[]string{"*.md"}, "CLAUDE.md", true},
+		{[]string{"*.md"}, "skills/qa/SKILL.md", false},
+		{[]string{"commands", "CLAUDE.md"}, "CLAUDE.md", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPaths(tt.patterns, tt.path); got != tt.want {
+			t.Errorf("MatchPaths(%v, %q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePathPatterns_RejectsEscapes(t *testing.T) {
+	for _, pattern := range []string{"../etc", "/etc/passwd", ".", "skills/["} {
+		if err := ValidatePathPatterns([]string{pattern}); err == nil {
+			t.Errorf("expected error for pattern %q", pattern)
+		}
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
+
+func assertContent(t *testing.T, dir, name, want string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	if string(data) != want {
+		t.Errorf("expected %s to contain %q, got %q", name, want, string(data))
+	}
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pt/ccd/internal/config"
+	"github.com/pt/ccd/internal/output"
+)
+
+// Contents is a read-only view of files keyed by target-relative path.
+// It is implemented by snapshot archives and by the live target directory.
+type Contents interface {
+	Files() map[string]FileEntry
+	ReadFile(relPath string) ([]byte, error)
+}
+
+// Files returns the regular files stored in the archive.
+func (a *Archive) Files() map[string]FileEntry {
+	files := make(map[string]FileEntry)
+	for _, e := range a.Entries {
+		if !e.IsDir {
+			files[e.Path] = FileEntry{Path: e.Path, Size: e.Size}
+		}
+	}
+	return files
+}
+
+// ReadFile returns the content of a file stored in the archive.
+func (a *Archive) ReadFile(relPath string) ([]byte, error) {
+	relPath = filepath.Clean(relPath)
+	for i := range a.Entries {
+		entry := &a.Entries[i]
+		if entry.IsDir || entry.Path != relPath {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("file not found in snapshot: %s", relPath)
+}
+
+// DirContents exposes the files of a directory tree as Contents.
+type DirContents struct {
+	Root  string
+	files map[string]FileEntry
+}
+
+// ScanTarget collects the target files a snapshot created now would
+// contain, using the same mapping and extra path scope as CreateSnapshot.
+func ScanTarget(targetDir string, mappings []config.Mapping, extraPaths []string) (*DirContents, error) {
+	dc := &DirContents{Root: targetDir, files: make(map[string]FileEntry)}
+
+	extras, err := ResolveExtraPaths(targetDir, extraPaths, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, basePath := range append(backupRoots(targetDir, mappings), existingPaths(targetDir, extras)...) {
+		err := filepath.Walk(filepath.Join(targetDir, basePath), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			relPath, err := filepath.Rel(targetDir, path)
+			if err != nil {
+				return err
+			}
+			dc.files[relPath] = FileEntry{Path: relPath, Size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan target: %w", err)
+		}
+	}
+
+	return dc, nil
+}
+
+// Files returns the scanned files.
+func (d *DirContents) Files() map[string]FileEntry {
+	return d.files
+}
+
+// ReadFile reads a file relative to the scanned root.
+func (d *DirContents) ReadFile(relPath string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.Root, relPath))
+}
+
+// Compare lists the changes that turn the old contents into the new ones.
+// Files of equal size are compared byte by byte.
+func Compare(old, new Contents) ([]output.FileChange, error) {
+	oldFiles := old.Files()
+	newFiles := new.Files()
+
+	var changes []output.FileChange
+
+	for path, newEntry := range newFiles {
+		oldEntry, exists := oldFiles[path]
+		if !exists {
+			changes = append(changes, output.FileChange{Path: path, Operation: "create", Size: newEntry.Size})
+			continue
+		}
+
+		same := oldEntry.Size == newEntry.Size
+		if same {
+			oldData, err := old.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			newData, err := new.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			same = bytes.Equal(oldData, newData)
+		}
+		if !same {
+			changes = append(changes, output.FileChange{Path: path, Operation: "update", Size: newEntry.Size})
+		}
+	}
+
+	for path, oldEntry := range oldFiles {
+		if _, exists := newFiles[path]; !exists {
+			changes = append(changes, output.FileChange{Path: path, Operation: "delete", Size: oldEntry.Size})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
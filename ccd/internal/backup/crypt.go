@@ -0,0 +1,303 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+// Encrypted snapshots start with encryptionMagic, followed by the length of
+// the JSON EncryptionHeader as a big-endian uint32, the header itself, and
+// the zip archive sealed with AES-256-GCM in chunks. Each chunk's nonce is
+// the header's nonce prefix, the chunk counter and a final-chunk flag, so
+// chunks cannot be reordered or the stream truncated undetected. The magic
+// and header are authenticated as additional data of every chunk.
+const (
+	encryptionMagic   = "CCDENC1\n"
+	encryptionVersion = 1
+
+	KDFPassphrase = "pbkdf2-sha256"
+	KDFKeyFile    = "key-file"
+
+	pbkdf2Iterations = 600000
+	maxIterations    = 10 * pbkdf2Iterations
+	chunkSize        = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+	noncePrefixSize  = 7
+	minKeyFileSize   = 16
+)
+
+// EncryptionHeader is the unencrypted header of an encrypted snapshot. It
+// carries the snapshot metadata so snapshots can be listed without the
+// key; the header is only authenticated once the snapshot is decrypted.
+type EncryptionHeader struct {
+	Version     int       `json:"version"`
+	KDF         string    `json:"kdf"`
+	Salt        []byte    `json:"salt"`
+	Iterations  int       `json:"iterations,omitempty"`
+	NoncePrefix []byte    `json:"nonce_prefix"`
+	ChunkSize   int       `json:"chunk_size"`
+	Timestamp   time.Time `json:"timestamp"`
+	TargetDir   string    `json:"target_dir"`
+	Metadata    Metadata  `json:"metadata"`
+}
+
+// Keys supplies the secret used to encrypt and decrypt snapshots. A key
+// file takes precedence for new snapshots; otherwise Passphrase is called,
+// at most once, when a snapshot is actually encrypted or decrypted. confirm
+// is set when the passphrase will protect a new snapshot.
+type Keys struct {
+	KeyFile    string
+	Passphrase func(confirm bool) ([]byte, error)
+
+	passphrase []byte
+}
+
+// KeysFromConfig returns the keys for backup.encryption. The passphrase
+// function is used when no key file is configured.
+func KeysFromConfig(cfg config.EncryptionConfig, passphrase func(confirm bool) ([]byte, error)) *Keys {
+	return &Keys{KeyFile: config.ExpandPath(cfg.KeyFile), Passphrase: passphrase}
+}
+
+func (k *Keys) getPassphrase(confirm bool) ([]byte, error) {
+	if k.passphrase != nil {
+		return k.passphrase, nil
+	}
+	if k.Passphrase == nil {
+		return nil, fmt.Errorf("snapshot is encrypted with a passphrase but none is available")
+	}
+	passphrase, err := k.Passphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	k.passphrase = passphrase
+	return passphrase, nil
+}
+
+func (k *Keys) readKeyFile() ([]byte, error) {
+	if k.KeyFile == "" {
+		return nil, fmt.Errorf("snapshot is encrypted with a key file; set backup.encryption.key_file")
+	}
+	material, err := os.ReadFile(k.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(material) < minKeyFileSize {
+		return nil, fmt.Errorf("key file %s is too short (at least %d bytes required)", k.KeyFile, minKeyFileSize)
+	}
+	return material, nil
+}
+
+// newHeader prepares the header for a new encrypted snapshot and derives
+// its key.
+func (k *Keys) newHeader() (*EncryptionHeader, []byte, error) {
+	h := &EncryptionHeader{
+		Version:     encryptionVersion,
+		Salt:        make([]byte, 16),
+		NoncePrefix: make([]byte, noncePrefixSize),
+		ChunkSize:   chunkSize,
+	}
+	if _, err := rand.Read(h.Salt); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(h.NoncePrefix); err != nil {
+		return nil, nil, err
+	}
+
+	if k.KeyFile != "" {
+		h.KDF = KDFKeyFile
+	} else {
+		h.KDF = KDFPassphrase
+		h.Iterations = pbkdf2Iterations
+	}
+
+	key, err := k.deriveKey(h, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, key, nil
+}
+
+// deriveKey returns the AES-256 key for the header's KDF.
+func (k *Keys) deriveKey(h *EncryptionHeader, encrypting bool) ([]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("snapshot is encrypted and no key is available")
+	}
+
+	switch h.KDF {
+	case KDFKeyFile:
+		material, err := k.readKeyFile()
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(sha256.New, material)
+		mac.Write(h.Salt)
+		return mac.Sum(nil), nil
+	case KDFPassphrase:
+		// The header is not authenticated yet, so a tampered iteration
+		// count must not make the derivation run for hours
+		if h.Iterations < 1 || h.Iterations > maxIterations {
+			return nil, fmt.Errorf("invalid key derivation iterations %d (expected 1 to %d)", h.Iterations, maxIterations)
+		}
+		passphrase, err := k.getPassphrase(encrypting)
+		if err != nil {
+			return nil, err
+		}
+		return pbkdf2SHA256(passphrase, h.Salt, h.Iterations, 32), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", h.KDF)
+	}
+}
+
+// encryptSnapshot writes the encrypted form of the archive read from r.
+func encryptSnapshot(w io.Writer, r io.Reader, h *EncryptionHeader, key []byte) error {
+	headerData, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	aad := encodeHeader(headerData)
+	if _, err := w.Write(aad); err != nil {
+		return err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(r, h.ChunkSize)
+	buf := make([]byte, h.ChunkSize)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		_, peekErr := br.Peek(1)
+		final := peekErr != nil
+
+		sealed := aead.Seal(nil, chunkNonce(h.NoncePrefix, counter, final), buf[:n], aad)
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// readEncryptionHeader parses the header of an encrypted snapshot. It
+// returns nil when obj is not encrypted.
+func readEncryptionHeader(obj Object) (*EncryptionHeader, []byte, error) {
+	prefix := make([]byte, len(encryptionMagic)+4)
+	if _, err := obj.ReadAt(prefix, 0); err != nil || string(prefix[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, nil, nil
+	}
+
+	length := binary.BigEndian.Uint32(prefix[len(encryptionMagic):])
+	if int64(length) > obj.Size()-int64(len(prefix)) {
+		return nil, nil, fmt.Errorf("invalid encrypted snapshot header")
+	}
+	headerData := make([]byte, length)
+	if _, err := obj.ReadAt(headerData, int64(len(prefix))); err != nil {
+		return nil, nil, fmt.Errorf("failed to read encrypted snapshot header: %w", err)
+	}
+
+	var h EncryptionHeader
+	if err := json.Unmarshal(headerData, &h); err != nil {
+		return nil, nil, fmt.Errorf("invalid encrypted snapshot header: %w", err)
+	}
+	if h.Version != encryptionVersion {
+		return nil, nil, fmt.Errorf("unsupported encrypted snapshot version %d", h.Version)
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > maxChunkSize || len(h.NoncePrefix) != noncePrefixSize {
+		return nil, nil, fmt.Errorf("invalid encrypted snapshot header")
+	}
+	return &h, encodeHeader(headerData), nil
+}
+
+// decryptSnapshot returns the decrypted archive of an encrypted snapshot.
+func decryptSnapshot(obj Object, h *EncryptionHeader, aad []byte, keys *Keys) (Object, error) {
+	key, err := keys.deriveKey(h, false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := io.NewSectionReader(obj, int64(len(aad)), obj.Size()-int64(len(aad)))
+	sealedSize := h.ChunkSize + aead.Overhead()
+	buf := make([]byte, sealedSize)
+
+	var plain bytes.Buffer
+	var offset int64
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				err = errors.New("unexpected end of data")
+			}
+			return nil, fmt.Errorf("failed to decrypt snapshot: %w", err)
+		}
+		offset += int64(n)
+		final := offset == r.Size()
+
+		opened, err := aead.Open(buf[:0], chunkNonce(h.NoncePrefix, counter, final), buf[:n], aad)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt snapshot: wrong key or corrupted data")
+		}
+		plain.Write(opened)
+		if final {
+			return memoryObject{bytes.NewReader(plain.Bytes())}, nil
+		}
+	}
+}
+
+func encodeHeader(headerData []byte) []byte {
+	out := make([]byte, 0, len(encryptionMagic)+4+len(headerData))
+	out = append(out, encryptionMagic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(headerData)))
+	return append(out, headerData...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// pbkdf2SHA256 derives a key with PBKDF2 (RFC 8018) and HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	return pbkdf2.Key(password, salt, iterations, keyLen, sha256.New)
+}
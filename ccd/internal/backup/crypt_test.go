@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "backup.key")
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return path
+}
+
+func TestEncryptedSnapshot_KeyFileRoundTrip(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	keys := &Keys{KeyFile: writeKeyFile(t)}
+
+	writeFile(t, targetDir, "settings.json", `{"token": "secret-token"}`)
+
+	// Incompressible content spanning several encryption chunks
+	large := make([]byte, 3*chunkSize+100)
+	rand.Read(large)
+	writeFile(t, targetDir, "large.bin", string(large))
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:  targetDir,
+		Store:      NewLocalStore(backupDir),
+		Metadata:   Metadata{Reason: ReasonManual, Label: "before-upgrade"},
+		Encryption: keys,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(backupDir, snapshot.Name))
+	if bytes.Contains(raw, []byte("secret-token")) || bytes.Contains(raw, []byte(ManifestFilename)) {
+		t.Error("expected snapshot contents and manifest to be encrypted")
+	}
+
+	snapshots, err := ListSnapshots(NewLocalStore(backupDir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !snapshots[0].Encrypted || snapshots[0].Metadata.Label != "before-upgrade" {
+		t.Errorf("expected public metadata of encrypted snapshot, got %+v", snapshots[0])
+	}
+
+	if _, err := snapshots[0].Open(nil); err == nil {
+		t.Error("expected error opening encrypted snapshot without keys")
+	}
+	if _, err := snapshots[0].Open(&Keys{KeyFile: writeKeyFile(t)}); err == nil {
+		t.Error("expected error opening encrypted snapshot with the wrong key")
+	}
+
+	writeFile(t, targetDir, "settings.json", "{}")
+	if err := RestoreSnapshot(&snapshots[0], targetDir, RestoreOptions{Keys: keys}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "settings.json", `{"token": "secret-token"}`)
+	assertContent(t, targetDir, "large.bin", string(large))
+}
+
+func TestEncryptedSnapshot_Passphrase(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	calls := 0
+	passphrase := func(confirm bool) ([]byte, error) {
+		calls++
+		return []byte("correct horse battery staple"), nil
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:  targetDir,
+		Store:      NewLocalStore(backupDir),
+		Encryption: &Keys{Passphrase: passphrase},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wrong := &Keys{Passphrase: func(bool) ([]byte, error) { return []byte("guess"), nil }}
+	if _, err := snapshot.Open(wrong); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("expected wrong key error, got %v", err)
+	}
+
+	keys := &Keys{Passphrase: passphrase}
+	for i := 0; i < 2; i++ {
+		archive, err := snapshot.Open(keys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := archive.Verify(); err != nil {
+			t.Errorf("unexpected verify error: %v", err)
+		}
+		archive.Close()
+	}
+	if calls != 2 {
+		t.Errorf("expected passphrase to be requested once per Keys, got %d calls", calls)
+	}
+}
+
+func TestEncryptedSnapshot_RejectsExcessiveIterations(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	calls := 0
+	keys := &Keys{Passphrase: func(bool) ([]byte, error) {
+		calls++
+		return []byte("correct horse battery staple"), nil
+	}}
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:  targetDir,
+		Store:      NewLocalStore(backupDir),
+		Encryption: keys,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(backupDir, snapshot.Name)
+	raw, _ := os.ReadFile(path)
+	tampered := bytes.Replace(raw, []byte(`"iterations":600000,`), []byte(`"iterations":2000000000,`), 1)
+	if bytes.Equal(tampered, raw) {
+		t.Fatal("iterations not found in the snapshot header")
+	}
+	// The header length prefix must match the edited header
+	binary.BigEndian.PutUint32(tampered[len(encryptionMagic):], binary.BigEndian.Uint32(raw[len(encryptionMagic):])+4)
+	if err := os.WriteFile(path, tampered, 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	calls = 0
+	_, err = snapshot.Open(&Keys{Passphrase: keys.Passphrase})
+	if err == nil || !strings.Contains(err.Error(), "iterations 2000000000") {
+		t.Errorf("expected excessive iterations to be rejected, got %v", err)
+	}
+	if calls != 0 {
+		t.Error("expected the passphrase not to be requested")
+	}
+}
+
+func TestEncryptedSnapshot_DetectsTampering(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	keys := &Keys{KeyFile: writeKeyFile(t)}
+
+	large := make([]byte, 2*chunkSize)
+	rand.Read(large)
+	writeFile(t, targetDir, "large.bin", string(large))
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:  targetDir,
+		Store:      NewLocalStore(backupDir),
+		Metadata:   Metadata{Label: "original"},
+		Encryption: keys,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(backupDir, snapshot.Name)
+	raw, _ := os.ReadFile(path)
+
+	// Dropping whole trailing chunks must be detected too
+	headerEnd := len(encryptionMagic) + 4 + int(binary.BigEndian.Uint32(raw[len(encryptionMagic):]))
+	tampered := map[string][]byte{
+		"flipped bit":     append([]byte(nil), raw...),
+		"truncated":       raw[:headerEnd+chunkSize+16],
+		"edited metadata": bytes.Replace(raw, []byte(`"label":"original"`), []byte(`"label":"modified"`), 1),
+	}
+	tampered["flipped bit"][len(raw)-1] ^= 1
+
+	for name, data := range tampered {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+		if _, err := snapshot.Open(keys); err == nil {
+			t.Errorf("%s: expected decryption to fail", name)
+		}
+	}
+}
+
+func TestArchiveVerify_DetectsCorruption(t *testing.T) {
+	snapshot := writeCorruptSnapshot(t, t.TempDir(), true)
+
+	archive, err := snapshot.Open(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer archive.Close()
+
+	if _, err := archive.Verify(); err == nil || !strings.Contains(err.Error(), "skills/broken.md") {
+		t.Errorf("expected verify to report the corrupt file, got %v", err)
+	}
+}
+
+// TestPBKDF2SHA256 uses the PBKDF2-HMAC-SHA256 test vector from RFC 7914.
+func TestPBKDF2SHA256(t *testing.T) {
+	got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64))
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got != want {
+		t.Errorf("unexpected derived key:\n got: %s\nwant: %s", got, want)
+	}
+}
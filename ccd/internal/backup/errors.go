@@ -0,0 +1,18 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AmbiguousSnapshotError is returned when an identifier matches more than
+// one snapshot.
+type AmbiguousSnapshotError struct {
+	Identifier string
+	Candidates []string
+}
+
+func (e *AmbiguousSnapshotError) Error() string {
+	return fmt.Sprintf("snapshot %q is ambiguous, it matches:\n  %s",
+		e.Identifier, strings.Join(e.Candidates, "\n  "))
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+// Format is the archive format of a snapshot file.
+type Format string
+
+const (
+	FormatZip    Format = "zip"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+)
+
+// formats lists the supported formats; snapshot names end in "." + format.
+var formats = []Format{FormatZip, FormatTarGz, FormatTarZst}
+
+// formatTar is an uncompressed tar, as produced by GitStore. It is only
+// read, never written.
+const formatTar Format = "tar"
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Compression selects the format and compression level of new snapshots.
+// The zero value writes deflate zips at the default level.
+type Compression struct {
+	// Format defaults to FormatZip.
+	Format Format
+	// Level is 1-9 for zip and tar.gz and 1-22 for tar.zst; 0 selects the
+	// format's default level.
+	Level int
+}
+
+func (c Compression) format() Format {
+	if c.Format == "" {
+		return FormatZip
+	}
+	return c.Format
+}
+
+// Validate reports an unknown format or an out-of-range level.
+func (c Compression) Validate() error {
+	switch c.format() {
+	case FormatZip, FormatTarGz, FormatTarZst:
+	default:
+		return fmt.Errorf("unknown backup format %q (expected zip, tar.gz or tar.zst)", c.Format)
+	}
+
+	maxLevel := config.MaxCompressionLevel(string(c.format()))
+	if c.Level < 0 || c.Level > maxLevel {
+		return fmt.Errorf("compression level %d is out of range for %s (1-%d, or 0 for the default)",
+			c.Level, c.format(), maxLevel)
+	}
+	return nil
+}
+
+// detectFormat identifies the archive format from the start of a snapshot
+// file, independent of its name.
+func detectFormat(r io.ReaderAt) (Format, error) {
+	// Long enough for the "ustar" magic of a tar header
+	magic := make([]byte, 262)
+	n, _ := r.ReadAt(magic, 0)
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK")):
+		return FormatZip, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return FormatTarZst, nil
+	case len(magic) == 262 && bytes.HasPrefix(magic[257:], []byte("ustar")):
+		return formatTar, nil
+	}
+	return "", fmt.Errorf("unrecognized snapshot format")
+}
+
+// archiveWriter writes the entries of a new snapshot.
+type archiveWriter interface {
+	// Add stores a file or directory found at path under relPath.
+	Add(relPath, path string, info os.FileInfo) error
+	// AddBytes stores generated content such as the manifest.
+	AddBytes(name string, data []byte) error
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, c Compression) (archiveWriter, error) {
+	switch c.format() {
+	case FormatTarGz:
+		level := gzip.DefaultCompression
+		if c.Level != 0 {
+			level = c.Level
+		}
+		gz, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{compressor: gz, tw: tar.NewWriter(gz)}, nil
+
+	case FormatTarZst:
+		level := zstd.SpeedDefault
+		if c.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{compressor: zw, tw: tar.NewWriter(zw)}, nil
+
+	default:
+		zw := zip.NewWriter(w)
+		if c.Level != 0 {
+			zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, c.Level)
+			})
+		}
+		return &zipWriter{zw: zw}, nil
+	}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) Add(relPath, path string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = relPath
+	if info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	writer, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return copyFile(writer, path)
+}
+
+func (w *zipWriter) AddBytes(name string, data []byte) error {
+	writer, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// tarWriter writes a tar stream through a streaming compressor. Only
+// regular files and directories are stored.
+type tarWriter struct {
+	compressor io.WriteCloser
+	tw         *tar.Writer
+}
+
+func (w *tarWriter) Add(relPath, path string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	header.Name = filepath.ToSlash(relPath)
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return copyFile(w.tw, path)
+}
+
+func (w *tarWriter) AddBytes(name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.compressor.Close()
+		return err
+	}
+	return w.compressor.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// newDecompressor returns the tar stream of a tar.gz or tar.zst snapshot.
+// The stream's checksum is verified once it has been read to the end.
+func newDecompressor(r io.Reader, format Format) (io.ReadCloser, error) {
+	switch format {
+	case formatTar:
+		return io.NopCloser(r), nil
+	case FormatTarGz:
+		return gzip.NewReader(r)
+	case FormatTarZst:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%s is not a tar format", format)
+}
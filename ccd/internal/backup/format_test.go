@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func TestCreateSnapshot_Formats(t *testing.T) {
+	for _, c := range []Compression{
+		{},
+		{Format: FormatZip, Level: 9},
+		{Format: FormatTarGz},
+		{Format: FormatTarGz, Level: 1},
+		{Format: FormatTarZst},
+		{Format: FormatTarZst, Level: 19},
+	} {
+		t.Run(string(c.format()), func(t *testing.T) {
+			targetDir := t.TempDir()
+			backupDir := t.TempDir()
+			mappings := []config.Mapping{
+				{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+				{Source: "skills/", Target: "skills/"},
+			}
+
+			writeFile(t, targetDir, "CLAUDE.md", "original")
+			writeFile(t, targetDir, "skills/tdd/SKILL.md", strings.Repeat("tdd ", 1000))
+
+			snapshot, err := CreateSnapshot(SnapshotOptions{
+				TargetDir:   targetDir,
+				Store:       NewLocalStore(backupDir),
+				Mappings:    mappings,
+				Metadata:    Metadata{Label: "formats"},
+				Compression: c,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasSuffix(snapshot.Name, "."+string(c.format())) {
+				t.Errorf("expected %s extension, got %s", c.format(), snapshot.Name)
+			}
+
+			snapshots, err := ListSnapshots(NewLocalStore(backupDir))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(snapshots) != 1 || snapshots[0].Metadata.Label != "formats" {
+				t.Fatalf("expected snapshot with metadata, got %+v", snapshots)
+			}
+
+			archive, err := snapshots[0].Open(nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n, err := archive.Verify(); err != nil || n != 2 {
+				t.Errorf("expected 2 verified files, got %d (%v)", n, err)
+			}
+			archive.Close()
+
+			writeFile(t, targetDir, "CLAUDE.md", "deployed")
+			writeFile(t, targetDir, "skills/foo/SKILL.md", "foo")
+			if err := RestoreSnapshot(&snapshots[0], targetDir, RestoreOptions{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertContent(t, targetDir, "CLAUDE.md", "original")
+			assertContent(t, targetDir, "skills/tdd/SKILL.md", strings.Repeat("tdd ", 1000))
+			if _, err := os.Stat(filepath.Join(targetDir, "skills/foo")); !os.IsNotExist(err) {
+				t.Error("expected files added after the snapshot to be removed")
+			}
+		})
+	}
+}
+
+func TestCreateSnapshot_EncryptedTarZst(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	keys := &Keys{KeyFile: writeKeyFile(t)}
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	_, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:   targetDir,
+		Store:       NewLocalStore(backupDir),
+		Encryption:  keys,
+		Compression: Compression{Format: FormatTarZst},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshot, err := FindSnapshot(NewLocalStore(backupDir), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writeFile(t, targetDir, "CLAUDE.md", "deployed")
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{Keys: keys}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+}
+
+func TestRestoreSnapshot_CorruptTarLeavesTargetIntact(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", strings.Repeat("original ", 1000))
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:   targetDir,
+		Store:       NewLocalStore(backupDir),
+		Compression: Compression{Format: FormatTarGz},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Damage the gzip trailer, which holds the checksum of the stream
+	path := filepath.Join(backupDir, snapshot.Name)
+	raw, _ := os.ReadFile(path)
+	raw[len(raw)-5] ^= 0xff
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "deployed")
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err == nil {
+		t.Fatal("expected restore of a corrupt snapshot to fail")
+	}
+	assertContent(t, targetDir, "CLAUDE.md", "deployed")
+}
+
+func TestCreateSnapshot_RejectsInvalidCompression(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	for _, c := range []Compression{
+		{Format: "rar"},
+		{Format: FormatZip, Level: 10},
+		{Format: FormatTarZst, Level: 23},
+		{Format: FormatTarGz, Level: -1},
+	} {
+		_, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Compression: c})
+		if err == nil {
+			t.Errorf("%+v: expected error", c)
+		}
+	}
+
+	if entries, _ := os.ReadDir(backupDir); len(entries) != 0 {
+		t.Errorf("expected no snapshots to be written, got %d", len(entries))
+	}
+}
+
+func TestDetectFormat_IgnoresName(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:   targetDir,
+		Store:       NewLocalStore(backupDir),
+		Compression: Compression{Format: FormatTarGz},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A tar.gz snapshot renamed to .zip is still read as tar.gz
+	renamed := strings.TrimSuffix(snapshot.Name, ".tar.gz") + SnapshotSuffix
+	if err := os.Rename(filepath.Join(backupDir, snapshot.Name), filepath.Join(backupDir, renamed)); err != nil {
+		t.Fatalf("failed to rename snapshot: %v", err)
+	}
+
+	found, err := FindSnapshot(NewLocalStore(backupDir), renamed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive, err := found.Open(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer archive.Close()
+
+	data, err := archive.ReadFile("CLAUDE.md")
+	if err != nil || string(data) != "original" {
+		t.Errorf("expected original content, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,435 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitRepoName is the repository the git backend keeps in backup.dir.
+const GitRepoName = "history.git"
+
+const defaultGitBranch = "main"
+
+// GitStore keeps snapshots as commits in a bare git repository, so the
+// target's history can be browsed, diffed and bisected with git. Each
+// commit holds the snapshot's files at their target-relative paths plus
+// its manifest; namespaces are branches. Commits are never removed, so
+// snapshots cannot be deleted or pruned.
+type GitStore struct {
+	Repo   string
+	branch string
+}
+
+func NewGitStore(repo string) *GitStore {
+	return &GitStore{Repo: repo, branch: defaultGitBranch}
+}
+
+func (s *GitStore) String() string {
+	return s.Repo + " (" + s.branch + ")"
+}
+
+func (s *GitStore) Sub(namespace string) Store {
+	sub := *s
+	sub.branch = namespace
+	if s.branch != defaultGitBranch {
+		sub.branch = s.branch + "/" + namespace
+	}
+	return &sub
+}
+
+func (s *GitStore) ref() string {
+	return "refs/heads/" + s.branch
+}
+
+// Put commits the contents of the snapshot archive read from r on top of
+// the branch.
+func (s *GitStore) Put(name string, r io.Reader) error {
+	if existing, err := s.find(name); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("snapshot %s: %w", name, os.ErrExist)
+	}
+
+	tmp, err := os.MkdirTemp("", "ccd-git-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	spool, err := os.Create(filepath.Join(tmp, "snapshot"))
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		spool.Close()
+		return err
+	}
+	obj := &fileObject{File: spool, size: size}
+
+	if header, _, err := readEncryptionHeader(obj); err != nil || header != nil {
+		spool.Close()
+		if err == nil {
+			err = fmt.Errorf("encrypted snapshots cannot be stored in git history")
+		}
+		return err
+	}
+
+	archive, err := newArchive(obj)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if repo := nestedRepo(archive); repo != "" {
+		return fmt.Errorf("%s is a git repository, which git history cannot hold; use backup.backend: archive or leave it out of the backup", repo)
+	}
+
+	workTree := filepath.Join(tmp, "tree")
+	if err := writeTree(archive, workTree); err != nil {
+		return fmt.Errorf("failed to prepare commit: %w", err)
+	}
+
+	if err := s.init(); err != nil {
+		return err
+	}
+
+	timestamp := time.Now()
+	if archive.Manifest != nil {
+		timestamp = archive.Manifest.Timestamp
+	}
+	date := fmt.Sprintf("%d %s", timestamp.Unix(), timestamp.Format("-0700"))
+	env := []string{
+		"GIT_INDEX_FILE=" + filepath.Join(tmp, "index"),
+		"GIT_WORK_TREE=" + workTree,
+		"GIT_AUTHOR_NAME=ccd", "GIT_AUTHOR_EMAIL=ccd@localhost", "GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=ccd", "GIT_COMMITTER_EMAIL=ccd@localhost", "GIT_COMMITTER_DATE=" + date,
+	}
+
+	// -f: ignore rules found among the snapshot's files must not drop them
+	if _, err := s.git(workTree, env, nil, "add", "--all", "--force", "."); err != nil {
+		return err
+	}
+	tree, err := s.git(workTree, env, nil, "write-tree")
+	if err != nil {
+		return err
+	}
+
+	parent, _ := s.git("", nil, nil, "rev-parse", "--verify", "--quiet", s.ref()+"^{commit}")
+	args := []string{"commit-tree", tree}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := s.git("", env, strings.NewReader(commitMessage(name, size, archive.Manifest)), args...)
+	if err != nil {
+		return err
+	}
+
+	// Fails if the branch moved since it was read
+	_, err = s.git("", nil, nil, "update-ref", s.ref(), commit, parent)
+	return err
+}
+
+// nestedRepo returns the first directory of the archive holding a .git
+// entry. git add would record it as a gitlink and drop its files.
+func nestedRepo(archive *Archive) string {
+	for _, entry := range archive.Entries {
+		parts := strings.Split(entry.Path, "/")
+		for i, part := range parts {
+			if part == ".git" {
+				if i == 0 {
+					return "."
+				}
+				return strings.Join(parts[:i], "/")
+			}
+		}
+	}
+	return ""
+}
+
+// writeTree extracts the archive and its manifest into dir.
+func writeTree(archive *Archive, dir string) error {
+	for i := range archive.Entries {
+		entry := &archive.Entries[i]
+		destPath := filepath.Join(dir, entry.Path)
+		if !strings.HasPrefix(destPath, dir+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file path in archive: %s", entry.Path)
+		}
+
+		if entry.IsDir {
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+		if err := extractEntry(entry, destPath); err != nil {
+			return fmt.Errorf("%s: %w", entry.Path, err)
+		}
+	}
+
+	// An empty target still gets a commit
+	if err := os.MkdirAll(dir, 0755); err != nil || archive.Manifest == nil {
+		return err
+	}
+	data, err := archive.Manifest.ToJSON()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFilename), data, 0644)
+}
+
+// commitMetadata is the snapshot metadata kept in the Metadata trailer,
+// so that List returns it without reading each commit's manifest.
+type commitMetadata struct {
+	Timestamp time.Time `json:"timestamp"`
+	TargetDir string    `json:"target_dir"`
+	Metadata
+}
+
+// commitMessage describes the snapshot in the subject and records its
+// name, size and metadata as trailers, which List reads back.
+func commitMessage(name string, size int64, manifest *BackupManifest) string {
+	subject := "Snapshot"
+	var body []string
+
+	if manifest != nil {
+		m := manifest.Metadata
+		switch {
+		case m.Rollback != nil:
+			subject = "Before rollback to " + m.Rollback.From
+		case m.Reason == ReasonDeploy && m.Mode != "":
+			subject = "Before " + m.Mode + " deploy"
+		case m.Reason == ReasonDeploy:
+			subject = "Before deploy"
+		case m.Reason == ReasonManual:
+			subject = "Manual snapshot"
+		}
+		if m.Changes != nil {
+			subject += fmt.Sprintf(" (+%d ~%d -%d)", m.Changes.Created, m.Changes.Updated, m.Changes.Deleted)
+		}
+		if m.Label != "" {
+			subject += " [" + m.Label + "]"
+		}
+
+		body = append(body, "Target: "+manifest.TargetDir)
+		if m.Source != nil {
+			source := "Source: " + m.Source.Commit
+			if m.Source.Dirty {
+				source += " (dirty)"
+			}
+			body = append(body, source)
+		}
+		if m.CCDVersion != "" {
+			body = append(body, "ccd: "+m.CCDVersion)
+		}
+	}
+
+	message := subject + "\n\n"
+	if len(body) > 0 {
+		message += strings.Join(body, "\n") + "\n\n"
+	}
+	message += fmt.Sprintf("Snapshot: %s\nSize: %d\n", name, size)
+	if manifest != nil {
+		// Marshaled JSON has no newlines, so it fits on the trailer line
+		data, _ := json.Marshal(commitMetadata{manifest.Timestamp, manifest.TargetDir, manifest.Metadata})
+		message += "Metadata: " + string(data) + "\n"
+	}
+	return message
+}
+
+// List reads the snapshots and their metadata from a single git log of
+// the branch.
+func (s *GitStore) List() ([]ObjectInfo, error) {
+	return s.log()
+}
+
+// log returns the snapshots committed on the branch, filtered by the
+// extra git log arguments.
+func (s *GitStore) log(args ...string) ([]ObjectInfo, error) {
+	if _, err := os.Stat(s.Repo); os.IsNotExist(err) {
+		return nil, nil
+	}
+	if _, err := s.git("", nil, nil, "rev-parse", "--verify", "--quiet", s.ref()); err != nil {
+		// Nothing committed on this branch yet
+		return nil, nil
+	}
+
+	args = append([]string{"log", "--format=%H%x00%B%x1e"}, args...)
+	out, err := s.git("", nil, nil, append(args, s.ref())...)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	for _, record := range strings.Split(out, "\x1e") {
+		commit, message, ok := strings.Cut(strings.TrimSpace(record), "\x00")
+		if !ok {
+			continue
+		}
+
+		info := ObjectInfo{Commit: commit}
+		for _, line := range strings.Split(message, "\n") {
+			if v, ok := strings.CutPrefix(line, "Snapshot: "); ok {
+				info.Name = v
+			} else if v, ok := strings.CutPrefix(line, "Size: "); ok {
+				info.Size, _ = strconv.ParseInt(v, 10, 64)
+			} else if v, ok := strings.CutPrefix(line, "Metadata: "); ok {
+				var m commitMetadata
+				if json.Unmarshal([]byte(v), &m) == nil {
+					info.Manifest = &BackupManifest{Timestamp: m.Timestamp, TargetDir: m.TargetDir, Metadata: m.Metadata}
+				}
+			}
+		}
+		if info.Name != "" {
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+// find returns the commit of the named snapshot, letting git search the
+// messages rather than listing every snapshot.
+func (s *GitStore) find(name string) (*ObjectInfo, error) {
+	objects, err := s.log("--extended-regexp", "--grep=^Snapshot: "+regexp.QuoteMeta(name)+"$")
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if obj.Name == name {
+			return &obj, nil
+		}
+	}
+	return nil, nil
+}
+
+// Open returns the commit as a tar archive. The manifest is put first so
+// that it can be read without going through the whole archive, and left
+// out of the commit's files that follow.
+func (s *GitStore) Open(name string) (Object, error) {
+	obj, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, os.ErrNotExist)
+	}
+
+	tree, err := s.gitBytes("archive", "--format=tar", obj.Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if manifest, err := s.gitBytes("cat-file", "blob", obj.Commit+":"+ManifestFilename); err == nil {
+		header := &tar.Header{Name: ManifestFilename, Mode: 0644, Size: int64(len(manifest)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	tr := tar.NewReader(bytes.NewReader(tree))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == ManifestFilename || header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return memoryObject{bytes.NewReader(buf.Bytes())}, nil
+}
+
+// Delete always fails: commits stay in the history.
+func (s *GitStore) Delete(name string) error {
+	return fmt.Errorf("snapshots in git history cannot be deleted")
+}
+
+// AppendOnly reports whether store keeps every snapshot, so that pruning
+// does not apply.
+func AppendOnly(store Store) bool {
+	if wrapped, ok := store.(interface{ Unwrap() Store }); ok {
+		store = wrapped.Unwrap()
+	}
+	_, ok := store.(*GitStore)
+	return ok
+}
+
+func (s *GitStore) init() error {
+	if _, err := os.Stat(s.Repo); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Repo), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	_, err := s.git("", nil, nil, "init", "--quiet", "--bare", "--initial-branch="+defaultGitBranch, s.Repo)
+	return err
+}
+
+// git runs a git command against the repository and returns its trimmed
+// standard output.
+func (s *GitStore) git(dir string, env []string, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", s.Repo}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitBytes runs a git command and returns its raw standard output.
+func (s *GitStore) gitBytes(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", s.Repo}, args...)...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,245 @@
+package backup
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+}
+
+func TestGitStore_SnapshotsAreCommits(t *testing.T) {
+	requireGit(t)
+
+	targetDir := t.TempDir()
+	repo := filepath.Join(t.TempDir(), GitRepoName)
+	store := TargetStore(NewGitStore(repo), targetDir)
+	mappings := []config.Mapping{
+		{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+		{Source: "skills/", Target: "skills/"},
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+
+	first, err := CreateSnapshot(SnapshotOptions{
+		TargetDir: targetDir,
+		Store:     store,
+		Mappings:  mappings,
+		Metadata: Metadata{
+			Reason:  ReasonDeploy,
+			Mode:    "merge",
+			Changes: &ChangeSummary{Created: 1, Updated: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(first.Name, ".") {
+		t.Errorf("expected a name without archive extension, got %s", first.Name)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "deployed")
+	writeFile(t, targetDir, "skills/foo/SKILL.md", "foo")
+	if _, err := CreateSnapshot(SnapshotOptions{
+		TargetDir:   targetDir,
+		Store:       store,
+		Mappings:    mappings,
+		Metadata:    Metadata{Reason: ReasonManual, Label: "second"},
+		Compression: Compression{Format: FormatTarZst},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+	if snapshots[0].Metadata.Label != "second" || snapshots[1].Name != first.Name {
+		t.Errorf("expected newest first with metadata, got %+v", snapshots)
+	}
+	if snapshots[1].Commit == "" || !SameTarget(snapshots[1].TargetDir, targetDir) {
+		t.Errorf("expected commit and target, got %+v", snapshots[1])
+	}
+
+	branch := "refs/heads/" + TargetNamespace(targetDir)
+	message, err := exec.Command("git", "--git-dir", repo, "log", "-1", "--format=%s", snapshots[1].Commit).Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	if got := strings.TrimSpace(string(message)); got != "Before merge deploy (+1 ~2 -0)" {
+		t.Errorf("unexpected commit message %q", got)
+	}
+	content, err := exec.Command("git", "--git-dir", repo, "show", branch+":CLAUDE.md").Output()
+	if err != nil || string(content) != "deployed" {
+		t.Errorf("expected branch to hold the latest files, got %q (%v)", content, err)
+	}
+
+	snapshot, err := FindSnapshot(store, snapshots[1].Commit[:7])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Name != first.Name {
+		t.Fatalf("expected %s by commit, got %s", first.Name, snapshot.Name)
+	}
+
+	obj, err := store.Open(snapshot.Name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var manifests int
+	tr := tar.NewReader(io.NewSectionReader(obj, 0, obj.Size()))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if header.Name == ManifestFilename {
+			manifests++
+		}
+	}
+	obj.Close()
+	if manifests != 1 {
+		t.Errorf("expected the manifest once in the opened archive, got %d", manifests)
+	}
+
+	archive, err := snapshot.Open(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n, err := archive.Verify(); err != nil || n != 2 {
+		t.Errorf("expected 2 verified files, got %d (%v)", n, err)
+	}
+	archive.Close()
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+	assertContent(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+	if _, err := os.Stat(filepath.Join(targetDir, "skills/foo")); !os.IsNotExist(err) {
+		t.Error("expected files added after the snapshot to be removed")
+	}
+}
+
+func TestGitStore_RejectsNestedRepositories(t *testing.T) {
+	requireGit(t)
+
+	targetDir := t.TempDir()
+	store := TargetStore(NewGitStore(filepath.Join(t.TempDir(), GitRepoName)), targetDir)
+	writeFile(t, targetDir, "plugins/tool/README.md", "tool")
+	writeFile(t, targetDir, "plugins/tool/.git/HEAD", "ref: refs/heads/main\n")
+
+	_, err := CreateSnapshot(SnapshotOptions{
+		TargetDir: targetDir,
+		Store:     store,
+		Mappings:  []config.Mapping{{Source: "plugins/", Target: "plugins/"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "plugins/tool is a git repository") {
+		t.Errorf("expected the nested repository to be rejected, got %v", err)
+	}
+}
+
+func TestGitStore_NeverPrunes(t *testing.T) {
+	requireGit(t)
+
+	targetDir := t.TempDir()
+	store := TargetStore(NewGitStore(filepath.Join(t.TempDir(), GitRepoName)), targetDir)
+
+	writeFile(t, targetDir, "CLAUDE.md", "content")
+	for i := 0; i < 3; i++ {
+		if _, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: store}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	pruned, err := PruneSnapshots(store, RetentionPolicy{KeepLast: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("expected nothing pruned, got %v", pruned)
+	}
+	if snapshots, _ := ListSnapshots(store); len(snapshots) != 3 {
+		t.Errorf("expected 3 snapshots, got %d", len(snapshots))
+	}
+}
+
+// openCounter counts the objects opened from a store.
+type openCounter struct {
+	Store
+	opens int
+}
+
+func (s *openCounter) Open(name string) (Object, error) {
+	s.opens++
+	return s.Store.Open(name)
+}
+
+func TestGitStore_ListsWithoutOpening(t *testing.T) {
+	requireGit(t)
+
+	targetDir := t.TempDir()
+	store := &openCounter{Store: NewGitStore(filepath.Join(t.TempDir(), GitRepoName))}
+
+	writeFile(t, targetDir, "CLAUDE.md", "content")
+	for _, label := range []string{"first", "second", "third"} {
+		if _, err := CreateSnapshot(SnapshotOptions{
+			TargetDir: targetDir,
+			Store:     store,
+			Metadata:  Metadata{Reason: ReasonManual, Label: label, Changes: &ChangeSummary{Created: 1}},
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	store.opens = 0
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.opens != 0 {
+		t.Errorf("expected listing to open no snapshots, opened %d", store.opens)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(snapshots))
+	}
+	newest := snapshots[0]
+	if newest.Metadata.Label != "third" || newest.Metadata.Changes == nil || !SameTarget(newest.TargetDir, targetDir) {
+		t.Errorf("expected the newest snapshot's metadata, got %+v", newest)
+	}
+}
+
+func TestStoreFromConfig_GitBackend(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := StoreFromConfig(config.BackupConfig{Dir: dir, Backend: BackendGit}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gs, ok := store.(*GitStore); !ok || gs.Repo != filepath.Join(dir, GitRepoName) {
+		t.Errorf("expected git store in %s, got %v", dir, store)
+	}
+
+	cfg := config.BackupConfig{Dir: dir, Backend: BackendGit, Encryption: config.EncryptionConfig{Enabled: true}}
+	if _, err := StoreFromConfig(cfg, ""); err == nil {
+		t.Error("expected error for encryption with the git backend")
+	}
+	if _, err := StoreFromConfig(config.BackupConfig{Dir: dir, Backend: "svn"}, ""); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
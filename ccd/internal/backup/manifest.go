@@ -6,15 +6,63 @@ import (
 )
 
 const (
-	ManifestVersion  = "1.0"
+	ManifestVersion  = "1.2"
 	ManifestFilename = "manifest.json"
 )
 
+// Snapshot triggers recorded in Metadata.Reason.
+const (
+	ReasonDeploy   = "deploy"
+	ReasonRollback = "rollback"
+	ReasonManual   = "manual"
+)
+
 type BackupManifest struct {
-	Version   string      `json:"version"`
-	Timestamp time.Time   `json:"timestamp"`
-	TargetDir string      `json:"target_dir"`
-	Files     []FileEntry `json:"files"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	TargetDir string    `json:"target_dir"`
+	Metadata
+	// Roots lists the mapped target paths the snapshot covers, whether or
+	// not they existed at the time. Restore removes files below them that
+	// the snapshot does not contain. "." stands for the whole target.
+	Roots []string `json:"roots,omitempty"`
+	// ExtraPaths lists the unmapped target paths captured from
+	// backup.extra_paths. Files below them form a separate restore scope.
+	ExtraPaths []string    `json:"extra_paths,omitempty"`
+	Files      []FileEntry `json:"files"`
+}
+
+// Metadata records why and from what a snapshot was taken.
+type Metadata struct {
+	Reason     string         `json:"reason,omitempty"`
+	Label      string         `json:"label,omitempty"`
+	Mode       string         `json:"mode,omitempty"`
+	CCDVersion string         `json:"ccd_version,omitempty"`
+	Source     *SourceInfo    `json:"source,omitempty"`
+	Changes    *ChangeSummary `json:"changes,omitempty"`
+	Rollback   *RollbackInfo  `json:"rollback,omitempty"`
+}
+
+// SourceInfo identifies the source checkout that was being deployed.
+type SourceInfo struct {
+	Commit string `json:"commit"`
+	Branch string `json:"branch,omitempty"`
+	Dirty  bool   `json:"dirty"`
+}
+
+// ChangeSummary counts the changes the triggering operation applied.
+type ChangeSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// RollbackInfo is recorded on pre-rollback snapshots so the rollback can
+// be undone with the same scope it was performed with.
+type RollbackInfo struct {
+	From         string   `json:"from"`
+	Paths        []string `json:"paths,omitempty"`
+	IncludeExtra bool     `json:"include_extra,omitempty"`
 }
 
 type FileEntry struct {
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// TargetNamespace returns the store namespace holding snapshots of
+// targetDir: its base name and a hash of its absolute path, e.g.
+// "claude-1a2b3c4d5e6f" for ~/.claude.
+func TargetNamespace(targetDir string) string {
+	abs := absTarget(targetDir)
+	sum := sha256.Sum256([]byte(abs))
+
+	base := strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, filepath.Base(abs))
+	if base == "" {
+		base = "target"
+	}
+
+	return base + "-" + hex.EncodeToString(sum[:6])
+}
+
+// SameTarget reports whether two target paths refer to the same directory.
+func SameTarget(a, b string) bool {
+	return absTarget(a) == absTarget(b)
+}
+
+func absTarget(targetDir string) string {
+	if abs, err := filepath.Abs(targetDir); err == nil {
+		return abs
+	}
+	return filepath.Clean(targetDir)
+}
+
+// TargetStore returns a view of store limited to snapshots of targetDir.
+// New snapshots go to the target's namespace. Snapshots stored at the root
+// of the store before namespaces existed are included when their manifest
+// names the same target, or names no target at all.
+func TargetStore(store Store, targetDir string) Store {
+	return &targetStore{
+		root:      store,
+		ns:        store.Sub(TargetNamespace(targetDir)),
+		targetDir: targetDir,
+		legacy:    make(map[string]bool),
+	}
+}
+
+type targetStore struct {
+	root      Store
+	ns        Store
+	targetDir string
+
+	// legacy records the root-level snapshots found by List
+	legacy map[string]bool
+}
+
+func (s *targetStore) String() string {
+	return s.ns.String()
+}
+
+func (s *targetStore) Sub(namespace string) Store {
+	return s.ns.Sub(namespace)
+}
+
+func (s *targetStore) Put(name string, r io.Reader) error {
+	return s.ns.Put(name, r)
+}
+
+func (s *targetStore) List() ([]ObjectInfo, error) {
+	objects, err := s.ns.List()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		seen[obj.Name] = true
+	}
+
+	rootObjects, err := s.root.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range rootObjects {
+		if seen[obj.Name] || !strings.HasPrefix(obj.Name, SnapshotPrefix) {
+			continue
+		}
+
+		legacy := Snapshot{Name: obj.Name, store: s.root}
+		if obj.Manifest != nil {
+			legacy.TargetDir = obj.Manifest.TargetDir
+		} else {
+			legacy.readMetadata()
+		}
+		if legacy.TargetDir != "" && !SameTarget(legacy.TargetDir, s.targetDir) {
+			continue
+		}
+
+		s.legacy[obj.Name] = true
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+func (s *targetStore) Open(name string) (Object, error) {
+	if s.legacy[name] {
+		return s.root.Open(name)
+	}
+	return s.ns.Open(name)
+}
+
+func (s *targetStore) Delete(name string) error {
+	if s.legacy[name] {
+		return s.root.Delete(name)
+	}
+	return s.ns.Delete(name)
+}
+
+// Unwrap returns the store new snapshots are written to.
+func (s *targetStore) Unwrap() Store {
+	return s.ns
+}
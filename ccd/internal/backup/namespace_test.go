@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTargetStore_IsolatesTargets(t *testing.T) {
+	backupDir := t.TempDir()
+	first := t.TempDir()
+	second := t.TempDir()
+
+	writeFile(t, first, "CLAUDE.md", "first")
+	writeFile(t, second, "CLAUDE.md", "second")
+
+	store := NewLocalStore(backupDir)
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: first, Store: TargetStore(store, first)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := CreateSnapshot(SnapshotOptions{TargetDir: second, Store: TargetStore(store, second)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(backupDir, TargetNamespace(first), snapshot.Name)); err != nil {
+		t.Errorf("expected snapshot in the target namespace: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(TargetStore(store, first))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 1 || !SameTarget(snapshots[0].TargetDir, first) {
+		t.Fatalf("expected only the snapshot of the first target, got %+v", snapshots)
+	}
+
+	if root, _ := ListSnapshots(store); len(root) != 0 {
+		t.Errorf("expected namespaced snapshots to be hidden from the root, got %d", len(root))
+	}
+}
+
+func TestTargetStore_IncludesLegacySnapshotsOfSameTarget(t *testing.T) {
+	backupDir := t.TempDir()
+	targetDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	store := NewLocalStore(backupDir)
+	legacy, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: store})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(TargetStore(store, otherDir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("expected legacy snapshot of another target to be excluded, got %d", len(snapshots))
+	}
+
+	targetStore := TargetStore(store, targetDir)
+	snapshot, err := FindSnapshot(targetStore, legacy.Name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "deployed")
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+
+	if err := snapshot.Delete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, legacy.Name)); !os.IsNotExist(err) {
+		t.Errorf("expected legacy snapshot to be deleted from the root, got %v", err)
+	}
+}
+
+func TestTargetNamespace(t *testing.T) {
+	a := TargetNamespace("/home/alice/.claude")
+	if a != TargetNamespace("/home/alice/.claude/") {
+		t.Errorf("expected trailing slash to be ignored")
+	}
+	if a == TargetNamespace("/home/bob/.claude") {
+		t.Errorf("expected different targets to get different namespaces")
+	}
+	if want := "claude-"; a[:len(want)] != want {
+		t.Errorf("expected namespace to start with the sanitized base name, got %q", a)
+	}
+}
@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MatchPaths reports whether relPath is selected by any of the patterns.
+// A pattern selects a path when it matches the path itself or one of its
+// parent directories, so "skills/tdd" and "skills/t*" both select
+// "skills/tdd/SKILL.md". An empty pattern list selects everything.
+func MatchPaths(patterns []string, relPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for _, pattern := range patterns {
+		pattern = normalizePattern(pattern)
+		for i := 1; i <= len(parts); i++ {
+			if matched, _ := path.Match(pattern, strings.Join(parts[:i], "/")); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidatePathPatterns rejects patterns that are malformed or could never
+// match a target-relative path.
+func ValidatePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		normalized := normalizePattern(pattern)
+		if normalized == "." || filepath.IsAbs(pattern) ||
+			normalized == ".." || strings.HasPrefix(normalized, "../") {
+			return fmt.Errorf("invalid path %q: must be relative to the target directory", pattern)
+		}
+		if _, err := path.Match(normalized, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isUnder reports whether relPath equals one of the roots or lies below it.
+func isUnder(roots []string, relPath string) bool {
+	relPath = filepath.Clean(relPath)
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if relPath == root || strings.HasPrefix(relPath, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizePattern(pattern string) string {
+	return path.Clean(filepath.ToSlash(strings.TrimSuffix(pattern, "/")))
+}
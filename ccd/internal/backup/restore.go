@@ -0,0 +1,432 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// RestoreOptions controls which snapshot entries are written back.
+type RestoreOptions struct {
+	// Paths limits the restore to entries matching these target-relative
+	// paths or glob patterns. Empty restores the whole snapshot.
+	Paths []string
+	// IncludeExtra also restores content captured from backup.extra_paths,
+	// which is left untouched by default.
+	IncludeExtra bool
+	// Keys decrypts encrypted snapshots.
+	Keys *Keys
+}
+
+// selects reports whether a snapshot entry is part of the restore.
+func (o RestoreOptions) selects(manifest *BackupManifest, relPath string) bool {
+	if !MatchPaths(o.Paths, relPath) {
+		return false
+	}
+	return o.IncludeExtra || manifest == nil || !isUnder(manifest.ExtraPaths, relPath)
+}
+
+// RestorePlan previews the effect of RestoreSnapshot on the target.
+type RestorePlan struct {
+	Changes []output.FileChange
+	// SkippedExtra counts extra-path files left out because
+	// IncludeExtra was not set.
+	SkippedExtra int
+}
+
+// PlanRestore lists the files RestoreSnapshot would write, marking each as
+// a create or an update depending on whether it exists in the target, and
+// the files it would delete because the snapshot does not contain them.
+func PlanRestore(snapshot *Snapshot, targetDir string, opts RestoreOptions) (*RestorePlan, error) {
+	if err := ValidatePathPatterns(opts.Paths); err != nil {
+		return nil, err
+	}
+
+	archive, err := snapshot.Open(opts.Keys)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	plan := &RestorePlan{}
+	for _, entry := range archive.Entries {
+		if entry.IsDir || !MatchPaths(opts.Paths, entry.Path) {
+			continue
+		}
+		if !opts.selects(archive.Manifest, entry.Path) {
+			plan.SkippedExtra++
+			continue
+		}
+
+		operation := "create"
+		if _, err := os.Lstat(filepath.Join(targetDir, entry.Path)); err == nil {
+			operation = "update"
+		}
+
+		plan.Changes = append(plan.Changes, output.FileChange{
+			Path:      entry.Path,
+			Operation: operation,
+			Size:      entry.Size,
+			ModTime:   entry.ModTime,
+		})
+	}
+
+	_, removed, err := findRemovals(archive, opts, targetDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range removed {
+		plan.Changes = append(plan.Changes, output.FileChange{
+			Path:      f.Path,
+			Operation: "delete",
+			Size:      f.Size,
+		})
+	}
+
+	return plan, nil
+}
+
+// findRemovals walks the mapped roots recorded in the manifest and returns
+// the selected target paths the snapshot does not contain. Directories
+// missing from the snapshot are returned whole; files lists every file
+// that would be removed. Snapshots without recorded roots remove nothing.
+func findRemovals(archive *Archive, opts RestoreOptions, targetDir string) (paths []string, files []FileEntry, err error) {
+	if archive.Manifest == nil || len(archive.Manifest.Roots) == 0 {
+		return nil, nil, nil
+	}
+
+	// Paths present in the snapshot, including the parents of its entries
+	known := make(map[string]bool)
+	for _, entry := range archive.Entries {
+		for p := filepath.Clean(entry.Path); p != "."; p = filepath.Dir(p) {
+			known[p] = true
+		}
+	}
+
+	for _, root := range archive.Manifest.Roots {
+		rootPath := filepath.Join(targetDir, root)
+		if _, err := os.Lstat(rootPath); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(targetDir, path)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case relPath == "." || known[relPath]:
+				return nil
+			case isUnder(paths, relPath):
+				// Inside a directory that is already being removed
+			case !MatchPaths(opts.Paths, relPath) || isUnder(archive.Manifest.ExtraPaths, relPath):
+				return nil
+			default:
+				paths = append(paths, relPath)
+			}
+
+			if !info.IsDir() {
+				files = append(files, FileEntry{Path: relPath, Size: info.Size()})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan target: %w", err)
+		}
+	}
+
+	return paths, files, nil
+}
+
+// RestoreSnapshot writes the selected snapshot entries back to the target.
+//
+// Under the mapped roots recorded in the manifest, target files that the
+// snapshot does not contain are removed, so the restored paths match the
+// snapshot exactly.
+//
+// Entries are first extracted into a staging directory next to the target
+// and verified. Only then is the staged content swapped in using renames,
+// which are undone if any of them fails. A corrupt or unreadable snapshot
+// therefore leaves the target exactly as it was.
+func RestoreSnapshot(snapshot *Snapshot, targetDir string, opts RestoreOptions) error {
+	if err := ValidatePathPatterns(opts.Paths); err != nil {
+		return err
+	}
+
+	archive, err := snapshot.Open(opts.Keys)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	targetDir = filepath.Clean(targetDir)
+
+	_, err = applyStaged(archive, opts, targetDir, func(tx *transaction, staged []string, stagedDir, replacedDir string) error {
+		removals, _, err := findRemovals(archive, opts, targetDir)
+		if err != nil {
+			return err
+		}
+
+		if archive.Manifest == nil && len(opts.Paths) == 0 {
+			// Legacy restore: the snapshot replaces the whole target
+			return swapTarget(tx, targetDir, stagedDir, replacedDir)
+		}
+		// Scoped restore: replace only the selected paths
+		return swapPaths(tx, archive, opts, append(staged, removals...), staged, targetDir, stagedDir, replacedDir)
+	})
+	return err
+}
+
+// ExtractSnapshot writes the selected snapshot entries into destDir, for
+// inspecting a snapshot without touching the live target. Existing files
+// at the same paths are replaced; nothing else in destDir is removed. It
+// returns the number of files written.
+func ExtractSnapshot(snapshot *Snapshot, destDir string, opts RestoreOptions) (int, error) {
+	if err := ValidatePathPatterns(opts.Paths); err != nil {
+		return 0, err
+	}
+
+	archive, err := snapshot.Open(opts.Keys)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+
+	destDir = filepath.Clean(destDir)
+
+	staged, err := applyStaged(archive, opts, destDir, func(tx *transaction, staged []string, stagedDir, replacedDir string) error {
+		return swapPaths(tx, archive, opts, staged, staged, destDir, stagedDir, replacedDir)
+	})
+	return len(staged), err
+}
+
+// applyStaged extracts the selected entries into a staging directory next
+// to targetDir and calls swap to move them into place. Renames recorded in
+// the transaction are reverted if swap fails.
+func applyStaged(archive *Archive, opts RestoreOptions, targetDir string, swap func(tx *transaction, staged []string, stagedDir, replacedDir string) error) ([]string, error) {
+	staging, err := newStagingDir(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	keepStaging := false
+	defer func() {
+		if !keepStaging {
+			os.RemoveAll(staging)
+		}
+	}()
+
+	stagedDir := filepath.Join(staging, "new")
+	replacedDir := filepath.Join(staging, "old")
+
+	staged, err := stageEntries(archive, opts, targetDir, stagedDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage snapshot, target left untouched: %w", err)
+	}
+
+	tx := &transaction{}
+	if err := swap(tx, staged, stagedDir, replacedDir); err != nil {
+		if rbErr := tx.rollback(); rbErr != nil {
+			keepStaging = true
+			return nil, fmt.Errorf("failed to restore (%v) and to revert partial changes (%v); original files are kept in %s",
+				err, rbErr, replacedDir)
+		}
+		return nil, fmt.Errorf("failed to restore, target left untouched: %w", err)
+	}
+
+	return staged, nil
+}
+
+// newStagingDir creates a temporary directory next to the target so that
+// staged files can be moved into place with renames on the same filesystem.
+func newStagingDir(targetDir string) (string, error) {
+	parent := filepath.Dir(targetDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(targetDir)+".ccd-restore-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return staging, nil
+}
+
+// stageEntries extracts the selected entries into stagedDir and returns the
+// target-relative paths of the staged files.
+func stageEntries(archive *Archive, opts RestoreOptions, targetDir, stagedDir string) ([]string, error) {
+	if err := os.MkdirAll(stagedDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var staged []string
+	for i := range archive.Entries {
+		entry := &archive.Entries[i]
+		if !opts.selects(archive.Manifest, entry.Path) {
+			continue
+		}
+
+		destPath := filepath.Join(targetDir, entry.Path)
+		if !strings.HasPrefix(destPath, targetDir+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("invalid file path in archive: %s", entry.Path)
+		}
+
+		stagedPath := filepath.Join(stagedDir, entry.Path)
+
+		if entry.IsDir {
+			if err := os.MkdirAll(stagedPath, entry.Mode|0700); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(stagedPath), 0755); err != nil {
+			return nil, err
+		}
+		if err := extractEntry(entry, stagedPath); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		staged = append(staged, entry.Path)
+	}
+
+	return staged, nil
+}
+
+// swapTarget replaces the whole target directory with the staged one.
+func swapTarget(tx *transaction, targetDir, stagedDir, replacedDir string) error {
+	if info, err := os.Stat(targetDir); err == nil {
+		if err := os.Chmod(stagedDir, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := tx.rename(targetDir, replacedDir); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return tx.rename(stagedDir, targetDir)
+}
+
+// swapPaths moves the selected target files and the given extra paths aside
+// and the staged files in.
+func swapPaths(tx *transaction, archive *Archive, opts RestoreOptions, aside, staged []string, targetDir, stagedDir, replacedDir string) error {
+	replaced := make(map[string]bool)
+	var toReplace []string
+	add := func(relPath string) {
+		if !replaced[relPath] {
+			replaced[relPath] = true
+			toReplace = append(toReplace, relPath)
+		}
+	}
+
+	if archive.Manifest != nil {
+		for _, f := range archive.Manifest.Files {
+			if opts.selects(archive.Manifest, f.Path) {
+				add(f.Path)
+			}
+		}
+	}
+	for _, relPath := range aside {
+		add(relPath)
+	}
+
+	for _, relPath := range toReplace {
+		destPath := filepath.Join(targetDir, relPath)
+		if _, err := os.Lstat(destPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := tx.rename(destPath, filepath.Join(replacedDir, relPath)); err != nil {
+			return err
+		}
+	}
+
+	for i := range archive.Entries {
+		entry := &archive.Entries[i]
+		if entry.IsDir && opts.selects(archive.Manifest, entry.Path) {
+			if err := os.MkdirAll(filepath.Join(targetDir, entry.Path), entry.Mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, relPath := range staged {
+		if err := tx.rename(filepath.Join(stagedDir, relPath), filepath.Join(targetDir, relPath)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractEntry writes an entry to destPath and verifies its size. The zip
+// reader checks the entry's CRC as it is read.
+func extractEntry(entry *Entry, destPath string) error {
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode)
+	if err != nil {
+		return err
+	}
+
+	srcFile, err := entry.Open()
+	if err != nil {
+		destFile.Close()
+		return err
+	}
+
+	written, err := io.Copy(destFile, srcFile)
+	srcFile.Close()
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if written != entry.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, extracted %d", entry.Size, written)
+	}
+	return nil
+}
+
+// transaction records renames so that a partially applied restore can be
+// reverted.
+type transaction struct {
+	moves []move
+}
+
+type move struct {
+	from string
+	to   string
+}
+
+func (t *transaction) rename(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	t.moves = append(t.moves, move{from: from, to: to})
+	return nil
+}
+
+// rollback undoes the recorded renames in reverse order.
+func (t *transaction) rollback() error {
+	var firstErr error
+	for i := len(t.moves) - 1; i >= 0; i-- {
+		m := t.moves[i]
+		if err := os.Rename(m.to, m.from); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	t.moves = nil
+	return firstErr
+}
@@ -0,0 +1,326 @@
+package backup
+
+import (
+	"archive/zip"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+// writeCorruptSnapshot stores a snapshot whose second file fails its CRC
+// check when extracted.
+func writeCorruptSnapshot(t *testing.T, backupDir string, withManifest bool) *Snapshot {
+	t.Helper()
+
+	now := time.Now()
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+	f, err := os.Create(filepath.Join(backupDir, SnapshotPrefix+now.Format(TimestampFormat)+SnapshotSuffix))
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	entries := []struct {
+		name    string
+		content string
+		crc     uint32
+	}{
+		{"CLAUDE.md", "restored", crc32.ChecksumIEEE([]byte("restored"))},
+		{"skills/broken.md", "corrupted", 0xdeadbeef},
+	}
+
+	manifest := NewManifest(now, backupDir)
+	for _, e := range entries {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               e.name,
+			Method:             zip.Store,
+			CRC32:              e.crc,
+			CompressedSize64:   uint64(len(e.content)),
+			UncompressedSize64: uint64(len(e.content)),
+		})
+		if err != nil {
+			t.Fatalf("failed to write entry: %v", err)
+		}
+		w.Write([]byte(e.content))
+		manifest.AddFile(e.name, int64(len(e.content)))
+	}
+
+	if withManifest {
+		data, _ := manifest.ToJSON()
+		w, _ := zw.Create(ManifestFilename)
+		w.Write(data)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to finalize snapshot: %v", err)
+	}
+
+	snapshot, err := FindSnapshot(NewLocalStore(backupDir), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return snapshot
+}
+
+func assertNoStagingLeft(t *testing.T, parent string) {
+	t.Helper()
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", parent, err)
+	}
+	for _, e := range entries {
+		if e.Name() != "target" && e.Name() != "backups" {
+			t.Errorf("unexpected leftover in %s: %s", parent, e.Name())
+		}
+	}
+}
+
+func TestRestoreSnapshot_CorruptLegacySnapshotLeavesTargetIntact(t *testing.T) {
+	parent := t.TempDir()
+	targetDir := filepath.Join(parent, "target")
+
+	writeFile(t, targetDir, "CLAUDE.md", "live")
+	writeFile(t, targetDir, "projects/data.md", "user data")
+	snapshot := writeCorruptSnapshot(t, filepath.Join(parent, "backups"), false)
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err == nil {
+		t.Fatal("expected error for corrupt snapshot")
+	}
+
+	assertContent(t, targetDir, "CLAUDE.md", "live")
+	assertContent(t, targetDir, "projects/data.md", "user data")
+	assertNoStagingLeft(t, parent)
+}
+
+func TestRestoreSnapshot_CorruptScopedSnapshotLeavesTargetIntact(t *testing.T) {
+	parent := t.TempDir()
+	targetDir := filepath.Join(parent, "target")
+
+	writeFile(t, targetDir, "CLAUDE.md", "live")
+	writeFile(t, targetDir, "skills/broken.md", "live skill")
+	snapshot := writeCorruptSnapshot(t, filepath.Join(parent, "backups"), true)
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err == nil {
+		t.Fatal("expected error for corrupt snapshot")
+	}
+
+	assertContent(t, targetDir, "CLAUDE.md", "live")
+	assertContent(t, targetDir, "skills/broken.md", "live skill")
+	assertNoStagingLeft(t, parent)
+}
+
+func TestRestoreSnapshot_LegacySwapReplacesTarget(t *testing.T) {
+	parent := t.TempDir()
+	targetDir := filepath.Join(parent, "target")
+	backupDir := t.TempDir()
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Drop the manifest to simulate a snapshot from an older ccd
+	stripManifest(t, filepath.Join(backupDir, snapshot.Name))
+
+	writeFile(t, targetDir, "CLAUDE.md", "changed")
+	writeFile(t, targetDir, "stray.md", "created later")
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertContent(t, targetDir, "CLAUDE.md", "original")
+	if _, err := os.Stat(filepath.Join(targetDir, "stray.md")); !os.IsNotExist(err) {
+		t.Error("expected legacy restore to replace the whole target")
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("expected only the target in %s, found %d entries", parent, len(entries))
+	}
+}
+
+func TestRestoreSnapshot_RemovesFilesAddedAfterSnapshot(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	mappings := []config.Mapping{
+		{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+		{Source: "skills/", Target: "skills/"},
+		{Source: "agents/", Target: "agents/"},
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "original")
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+	writeFile(t, targetDir, "projects/data.md", "user data")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Mappings: mappings})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A later deploy adds a skill and a mapped directory that did not exist
+	writeFile(t, targetDir, "skills/foo/SKILL.md", "foo")
+	writeFile(t, targetDir, "skills/tdd/extra.md", "extra")
+	writeFile(t, targetDir, "agents/reviewer.md", "agent")
+	writeFile(t, targetDir, "projects/new.md", "more user data")
+
+	plan, err := PlanRestore(snapshot, targetDir, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deletes := make(map[string]bool)
+	for _, c := range plan.Changes {
+		if c.Operation == "delete" {
+			deletes[c.Path] = true
+		}
+	}
+	for _, want := range []string{"skills/foo/SKILL.md", "skills/tdd/extra.md", "agents/reviewer.md"} {
+		if !deletes[want] {
+			t.Errorf("expected plan to delete %s, got %v", want, deletes)
+		}
+	}
+	if len(deletes) != 3 {
+		t.Errorf("expected 3 deletes, got %v", deletes)
+	}
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, gone := range []string{"skills/foo", "skills/tdd/extra.md", "agents"} {
+		if _, err := os.Stat(filepath.Join(targetDir, gone)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", gone)
+		}
+	}
+	assertContent(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+	assertContent(t, targetDir, "projects/new.md", "more user data")
+}
+
+func TestRestoreSnapshot_Paths_LimitsRemovals(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	mappings := []config.Mapping{{Source: "skills/", Target: "skills/"}}
+
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Mappings: mappings})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "skills/foo/SKILL.md", "foo")
+	writeFile(t, targetDir, "skills/bar/SKILL.md", "bar")
+
+	if err := RestoreSnapshot(snapshot, targetDir, RestoreOptions{Paths: []string{"skills/foo"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(targetDir, "skills/foo")); !os.IsNotExist(err) {
+		t.Error("expected skills/foo to be removed")
+	}
+	assertContent(t, targetDir, "skills/bar/SKILL.md", "bar")
+}
+
+func TestExtractSnapshot_LeavesTargetAndOtherFiles(t *testing.T) {
+	targetDir := t.TempDir()
+	backupDir := t.TempDir()
+	intoDir := filepath.Join(t.TempDir(), "target")
+	mappings := []config.Mapping{
+		{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+		{Source: "skills/", Target: "skills/"},
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "last tuesday")
+	writeFile(t, targetDir, "skills/tdd/SKILL.md", "tdd")
+
+	snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: NewLocalStore(backupDir), Mappings: mappings})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeFile(t, targetDir, "CLAUDE.md", "today")
+	writeFile(t, intoDir, "skills/notes.md", "mine")
+	writeFile(t, intoDir, "CLAUDE.md", "stale")
+
+	n, err := ExtractSnapshot(snapshot, intoDir, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 files extracted, got %d", n)
+	}
+
+	assertContent(t, intoDir, "CLAUDE.md", "last tuesday")
+	assertContent(t, intoDir, "skills/tdd/SKILL.md", "tdd")
+	assertContent(t, intoDir, "skills/notes.md", "mine")
+	assertContent(t, targetDir, "CLAUDE.md", "today")
+	assertNoStagingLeft(t, filepath.Dir(intoDir))
+}
+
+func TestExtractSnapshot_RejectsPathsOutsideDestination(t *testing.T) {
+	backupDir := t.TempDir()
+	parent := t.TempDir()
+	intoDir := filepath.Join(parent, "inspect")
+
+	f, err := os.Create(filepath.Join(backupDir, SnapshotPrefix+time.Now().Format(TimestampFormat)+SnapshotSuffix))
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("../escaped.md")
+	w.Write([]byte("outside"))
+	zw.Close()
+	f.Close()
+
+	snapshot, err := FindSnapshot(NewLocalStore(backupDir), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := ExtractSnapshot(snapshot, intoDir, RestoreOptions{}); err == nil {
+		t.Error("expected error for entry outside the destination")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped.md")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written outside the destination")
+	}
+}
+
+func stripManifest(t *testing.T, snapshotPath string) {
+	t.Helper()
+
+	reader, err := zip.OpenReader(snapshotPath)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	defer reader.Close()
+
+	tmpPath := snapshotPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	for _, file := range reader.File {
+		if file.Name == ManifestFilename {
+			continue
+		}
+		if err := zw.Copy(file); err != nil {
+			t.Fatalf("failed to copy entry: %v", err)
+		}
+	}
+	zw.Close()
+	f.Close()
+
+	if err := os.Rename(tmpPath, snapshotPath); err != nil {
+		t.Fatalf("failed to replace snapshot: %v", err)
+	}
+}
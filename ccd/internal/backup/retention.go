@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+// RetentionPolicy decides which snapshots survive pruning. A snapshot is
+// kept when any keep rule selects it, unless MaxAge or MaxTotalSize rule
+// it out. The newest snapshot and labeled snapshots are always kept.
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+
+	// MaxAge removes snapshots older than this; zero disables the limit.
+	MaxAge time.Duration
+	// MaxTotalSize caps the combined size of kept snapshots, dropping the
+	// oldest first; zero disables the limit.
+	MaxTotalSize int64
+}
+
+// PolicyFromConfig builds a RetentionPolicy from the backup config.
+// keep_last falls back to max_snapshots so older configs behave as before.
+func PolicyFromConfig(cfg config.BackupConfig) (RetentionPolicy, error) {
+	policy := RetentionPolicy{
+		KeepLast:    cfg.KeepLast,
+		KeepDaily:   cfg.KeepDaily,
+		KeepWeekly:  cfg.KeepWeekly,
+		KeepMonthly: cfg.KeepMonthly,
+	}
+	if policy.KeepLast == 0 {
+		policy.KeepLast = cfg.MaxSnapshots
+	}
+
+	if cfg.MaxAge != "" {
+		age, err := config.ParseAge(cfg.MaxAge)
+		if err != nil {
+			return policy, fmt.Errorf("backup.max_age: %w", err)
+		}
+		policy.MaxAge = age
+	}
+
+	if cfg.MaxTotalSize != "" {
+		size, err := config.ParseSize(cfg.MaxTotalSize)
+		if err != nil {
+			return policy, fmt.Errorf("backup.max_total_size: %w", err)
+		}
+		policy.MaxTotalSize = size
+	}
+
+	return policy, nil
+}
+
+// PruneDecision explains why a snapshot is kept or removed.
+type PruneDecision struct {
+	Snapshot Snapshot
+	Keep     bool
+	Reasons  []string
+}
+
+// PlanPrune applies the policy to snapshots, which must be sorted newest
+// first as returned by ListSnapshots.
+func PlanPrune(snapshots []Snapshot, policy RetentionPolicy, now time.Time) []PruneDecision {
+	decisions := make([]PruneDecision, len(snapshots))
+	for i, s := range snapshots {
+		decisions[i].Snapshot = s
+	}
+
+	keep := func(i int, reason string) {
+		decisions[i].Keep = true
+		decisions[i].Reasons = append(decisions[i].Reasons, reason)
+	}
+
+	for i := 0; i < len(snapshots) && i < policy.KeepLast; i++ {
+		keep(i, fmt.Sprintf("one of the newest %d (keep_last)", policy.KeepLast))
+	}
+
+	buckets := []struct {
+		count int
+		rule  string
+		key   func(time.Time) string
+	}{
+		{policy.KeepDaily, "keep_daily", func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{policy.KeepWeekly, "keep_weekly", func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{policy.KeepMonthly, "keep_monthly", func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+	}
+
+	for _, b := range buckets {
+		seen := make(map[string]bool)
+		for i, s := range snapshots {
+			if len(seen) >= b.count {
+				break
+			}
+			key := b.key(s.Timestamp)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep(i, fmt.Sprintf("newest of %s (%s)", key, b.rule))
+		}
+	}
+
+	if len(snapshots) > 0 && !decisions[0].Keep {
+		keep(0, "most recent snapshot")
+	}
+
+	for i := 1; i < len(decisions); i++ {
+		d := &decisions[i]
+		if label := d.Snapshot.Metadata.Label; label != "" {
+			d.Keep = true
+			d.Reasons = []string{fmt.Sprintf("labeled %q (protected)", label)}
+			continue
+		}
+		if !d.Keep {
+			d.Reasons = []string{"not selected by any keep rule"}
+			continue
+		}
+		if policy.MaxAge > 0 && now.Sub(d.Snapshot.Timestamp) > policy.MaxAge {
+			d.Keep = false
+			d.Reasons = []string{fmt.Sprintf("older than max_age (%s)", formatDuration(policy.MaxAge))}
+		}
+	}
+
+	if policy.MaxTotalSize > 0 {
+		var total int64
+		for i := range decisions {
+			d := &decisions[i]
+			if !d.Keep {
+				continue
+			}
+			total += d.Snapshot.Size
+			if i > 0 && total > policy.MaxTotalSize && d.Snapshot.Metadata.Label == "" {
+				total -= d.Snapshot.Size
+				d.Keep = false
+				d.Reasons = []string{fmt.Sprintf("exceeds max_total_size (%s)", FormatSize(policy.MaxTotalSize))}
+			}
+		}
+	}
+
+	return decisions
+}
+
+func formatDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+// PruneSnapshots removes the snapshots the policy does not keep and
+// returns their names. Append-only stores are left as they are.
+func PruneSnapshots(store Store, policy RetentionPolicy) ([]string, error) {
+	if AppendOnly(store) {
+		return nil, nil
+	}
+
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, d := range PlanPrune(snapshots, policy, time.Now()) {
+		if d.Keep {
+			continue
+		}
+		if err := d.Snapshot.Delete(); err != nil {
+			return pruned, fmt.Errorf("failed to remove %s: %w", d.Snapshot.Name, err)
+		}
+		pruned = append(pruned, d.Snapshot.Name)
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func snapshotsAt(times ...time.Time) []Snapshot {
+	snapshots := make([]Snapshot, len(times))
+	for i, ts := range times {
+		snapshots[i] = Snapshot{Name: ts.Format(TimestampFormat), Timestamp: ts, Size: 100}
+	}
+	return snapshots
+}
+
+func keptNames(decisions []PruneDecision) map[string]bool {
+	kept := make(map[string]bool)
+	for _, d := range decisions {
+		if d.Keep {
+			kept[d.Snapshot.Name] = true
+		}
+	}
+	return kept
+}
+
+func TestPlanPrune_KeepLast(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	snapshots := snapshotsAt(now, now.Add(-time.Hour), now.Add(-2*time.Hour), now.Add(-3*time.Hour))
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{KeepLast: 2}, now)
+
+	kept := keptNames(decisions)
+	if len(kept) != 2 || !kept[snapshots[0].Name] || !kept[snapshots[1].Name] {
+		t.Errorf("expected newest 2 kept, got %v", kept)
+	}
+	for _, d := range decisions[2:] {
+		if len(d.Reasons) == 0 {
+			t.Errorf("expected a reason for removing %s", d.Snapshot.Name)
+		}
+	}
+}
+
+func TestPlanPrune_DailyKeepsOlderDaysDespiteBurst(t *testing.T) {
+	now := time.Date(2026, 10, 18, 18, 0, 0, 0, time.Local)
+
+	// A busy afternoon of redeploys followed by last week's snapshots
+	var times []time.Time
+	for i := 0; i < 6; i++ {
+		times = append(times, now.Add(-time.Duration(i)*10*time.Minute))
+	}
+	lastWeek := now.AddDate(0, 0, -6)
+	times = append(times, lastWeek, lastWeek.Add(-time.Hour))
+	snapshots := snapshotsAt(times...)
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{KeepLast: 2, KeepDaily: 3}, now)
+
+	kept := keptNames(decisions)
+	if !kept[lastWeek.Format(TimestampFormat)] {
+		t.Errorf("expected newest snapshot from last week to be kept, got %v", kept)
+	}
+	if kept[lastWeek.Add(-time.Hour).Format(TimestampFormat)] {
+		t.Errorf("expected second snapshot of the same day to be removed")
+	}
+	if len(kept) != 3 {
+		t.Errorf("expected 3 kept snapshots, got %d: %v", len(kept), kept)
+	}
+}
+
+func TestPlanPrune_MaxAgeOverridesKeepRules(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	old := now.AddDate(0, -2, 0)
+	snapshots := snapshotsAt(now, old)
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{KeepMonthly: 6, MaxAge: 30 * 24 * time.Hour}, now)
+
+	if !decisions[0].Keep {
+		t.Error("expected newest snapshot to be kept")
+	}
+	if decisions[1].Keep {
+		t.Error("expected snapshot older than max_age to be removed")
+	}
+}
+
+func TestPlanPrune_MaxTotalSizeDropsOldest(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	snapshots := snapshotsAt(now, now.Add(-time.Hour), now.Add(-2*time.Hour))
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{KeepLast: 3, MaxTotalSize: 250}, now)
+
+	if !decisions[0].Keep || !decisions[1].Keep {
+		t.Error("expected the two newest snapshots to fit within the size limit")
+	}
+	if decisions[2].Keep {
+		t.Error("expected the oldest snapshot to exceed the size limit")
+	}
+}
+
+func TestPlanPrune_AlwaysKeepsNewest(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	snapshots := snapshotsAt(now.AddDate(-1, 0, 0))
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{MaxAge: time.Hour, MaxTotalSize: 1}, now)
+
+	if !decisions[0].Keep {
+		t.Error("expected the only snapshot to be kept")
+	}
+}
+
+func TestPlanPrune_LabeledSnapshotsAreProtected(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	snapshots := snapshotsAt(now, now.AddDate(0, -3, 0), now.AddDate(0, -4, 0))
+	snapshots[1].Metadata.Label = "known-good"
+
+	decisions := PlanPrune(snapshots, RetentionPolicy{KeepLast: 1, MaxAge: 24 * time.Hour, MaxTotalSize: 100}, now)
+
+	if !decisions[1].Keep {
+		t.Error("expected labeled snapshot to be kept")
+	}
+	if decisions[2].Keep {
+		t.Error("expected unlabeled old snapshot to be removed")
+	}
+}
+
+func TestPolicyFromConfig_FallsBackToMaxSnapshots(t *testing.T) {
+	policy, err := PolicyFromConfig(config.BackupConfig{MaxSnapshots: 5, KeepDaily: 7, MaxAge: "90d", MaxTotalSize: "1GB"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if policy.KeepLast != 5 {
+		t.Errorf("expected KeepLast=5, got %d", policy.KeepLast)
+	}
+	if policy.MaxAge != 90*24*time.Hour {
+		t.Errorf("expected MaxAge=90d, got %s", policy.MaxAge)
+	}
+	if policy.MaxTotalSize != 1<<30 {
+		t.Errorf("expected MaxTotalSize=1GB, got %d", policy.MaxTotalSize)
+	}
+}
+
+func TestPolicyFromConfig_InvalidMaxAge(t *testing.T) {
+	if _, err := PolicyFromConfig(config.BackupConfig{MaxAge: "soon"}); err == nil {
+		t.Error("expected error for invalid max_age")
+	}
+}
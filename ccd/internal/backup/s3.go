@@ -0,0 +1,476 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Options configures an S3-compatible store.
+type S3Options struct {
+	// Endpoint is the service URL, e.g. https://minio.example.com. It
+	// defaults to AWS S3 in Region.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3Store keeps snapshots as objects in an S3-compatible bucket. Requests
+// use path-style addressing and Signature Version 4, which AWS S3 and
+// self-hosted services such as MinIO both accept.
+type S3Store struct {
+	opts     S3Options
+	endpoint *url.URL
+}
+
+func NewS3Store(opts S3Options) (*S3Store, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, fmt.Errorf("credentials are required (access_key/secret_key or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", opts.Endpoint)
+	}
+
+	return &S3Store{opts: opts, endpoint: endpoint}, nil
+}
+
+func (s *S3Store) String() string {
+	return "s3://" + s.opts.Bucket + "/" + s.opts.Prefix
+}
+
+// Put uploads the object with If-None-Match so an existing snapshot is
+// never replaced. The upload needs the length and hash of the content up
+// front: a seekable r, such as the snapshot file CreateSnapshot writes, is
+// hashed in place and rewound, anything else is spooled to a temporary
+// file first. Snapshots stay far below the 5 GB limit of a single upload.
+func (s *S3Store) Put(name string, r io.Reader) error {
+	content, ok := r.(io.ReadSeeker)
+	if !ok {
+		spool, err := os.CreateTemp("", "ccd-s3-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err := io.Copy(spool, r); err != nil {
+			return err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		content = spool
+	}
+
+	start, err := content.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("If-None-Match", "*")
+	// The limit keeps the client from closing a caller's file
+	body := &payload{r: io.LimitReader(content, size), size: size, hash: hex.EncodeToString(hash.Sum(nil))}
+	resp, err := s.do(http.MethodPut, s.opts.Prefix+name, nil, header, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List() ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.opts.Prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bucket listing: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.opts.Prefix)
+			// Objects in nested "directories" belong to another prefix
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			objects = append(objects, ObjectInfo{Name: name, Size: c.Size})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Open returns the object without downloading it: its content is fetched
+// with ranged GETs as it is read, so reading a snapshot's metadata only
+// transfers the blocks holding it.
+func (s *S3Store) Open(name string) (Object, error) {
+	key := s.opts.Prefix + name
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("s3 HEAD %s: no content length", key)
+	}
+
+	return &s3Object{store: s, key: key, size: resp.ContentLength, blocks: make(map[int64][]byte)}, nil
+}
+
+func (s *S3Store) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, s.opts.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Sub(namespace string) Store {
+	sub := *s
+	sub.opts.Prefix = s.opts.Prefix + namespace + "/"
+	return &sub
+}
+
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (memoryObject) Close() error {
+	return nil
+}
+
+// Objects are read in blocks of s3BlockSize, and the most recently
+// fetched s3CachedBlocks are kept; sequential reads fetch each block once.
+const (
+	s3BlockSize    = 256 << 10
+	s3CachedBlocks = 4
+)
+
+// s3Object reads an object with ranged GETs.
+type s3Object struct {
+	store *S3Store
+	key   string
+	size  int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	// fetched lists the cached blocks, oldest first
+	fetched []int64
+}
+
+func (o *s3Object) Size() int64 {
+	return o.size
+}
+
+func (o *s3Object) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.blocks, o.fetched = nil, nil
+	return nil
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("s3 %s: negative offset", o.key)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off < o.size {
+		index := off / s3BlockSize
+		block, err := o.block(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], block[off-index*s3BlockSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block at index, fetching it unless it is cached.
+func (o *s3Object) block(index int64) ([]byte, error) {
+	if block, ok := o.blocks[index]; ok {
+		return block, nil
+	}
+	if o.blocks == nil {
+		return nil, fmt.Errorf("s3 %s: object is closed", o.key)
+	}
+
+	start := index * s3BlockSize
+	end := min(start+s3BlockSize, o.size)
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := o.store.do(http.MethodGet, o.key, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	block, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", o.key, err)
+	}
+	// A server ignoring Range sends the whole object
+	if resp.StatusCode == http.StatusOK && int64(len(block)) == o.size {
+		block = block[start:end]
+	}
+	if int64(len(block)) != end-start {
+		return nil, fmt.Errorf("s3 GET %s: expected %d bytes at offset %d, got %d", o.key, end-start, start, len(block))
+	}
+
+	if len(o.fetched) >= s3CachedBlocks {
+		delete(o.blocks, o.fetched[0])
+		o.fetched = o.fetched[1:]
+	}
+	o.blocks[index] = block
+	o.fetched = append(o.fetched, index)
+	return block, nil
+}
+
+// payload is a request body with its length and SHA-256 hash, which
+// signing requires before it is sent.
+type payload struct {
+	r    io.Reader
+	size int64
+	hash string
+}
+
+// s3Error is the error document returned by S3-compatible services.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for key in the bucket and returns the response
+// if it succeeded. body may be nil.
+func (s *S3Store) do(method, key string, query url.Values, header http.Header, body *payload) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.opts.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	// The path and query are sent encoded exactly as signV4 signs them
+	u.RawPath = canonicalURI(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	if body == nil {
+		body = &payload{r: http.NoBody, hash: sha256Hex(nil)}
+	}
+	req, err := http.NewRequest(method, u.String(), body.r)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = body.size
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	signV4(req, body.hash, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, time.Now())
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, key, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e s3Error
+		data, _ := io.ReadAll(resp.Body)
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+	}
+
+	return resp, nil
+}
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// signV4 adds AWS Signature Version 4 headers to req, whose body has the
+// given hex-encoded SHA-256. All headers already set on the request are
+// signed along with the host.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = uriEncode(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything except the RFC 3986 unreserved
+// characters, as SigV4 requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FindSnapshot returns the snapshot selected by identifier; see
+// SelectSnapshot.
+func FindSnapshot(store Store, identifier string) (*Snapshot, error) {
+	return SelectSnapshot(store, identifier, SnapshotFilter{})
+}
+
+// SelectSnapshot returns the snapshot selected by identifier among those
+// matching the filter, newest first:
+//   - "" selects the newest snapshot
+//   - "@N" selects the Nth snapshot before the newest, e.g. @1
+//   - a full snapshot name, or any part of one that matches a single
+//     snapshot, such as its ID
+//   - the commit of a snapshot in git history, or a prefix of at least
+//     4 characters
+//
+// A partial name matching several snapshots returns an
+// *AmbiguousSnapshotError listing them.
+func SelectSnapshot(store Store, identifier string, filter SnapshotFilter) (*Snapshot, error) {
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []Snapshot
+	for _, s := range snapshots {
+		if filter.Match(s) {
+			matched = append(matched, s)
+		}
+	}
+
+	if len(matched) == 0 {
+		if len(snapshots) > 0 {
+			return nil, fmt.Errorf("no matching snapshots found")
+		}
+		return nil, fmt.Errorf("no snapshots found")
+	}
+
+	if identifier == "" {
+		return &matched[0], nil
+	}
+
+	if strings.HasPrefix(identifier, "@") {
+		n, err := strconv.Atoi(identifier[1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid relative snapshot %q (expected @N, e.g. @1 for the previous snapshot)", identifier)
+		}
+		if n >= len(matched) {
+			return nil, fmt.Errorf("snapshot %s not found: only %d %s", identifier, len(matched), pluralSnapshots(len(matched)))
+		}
+		return &matched[n], nil
+	}
+
+	var candidates []Snapshot
+	for _, s := range matched {
+		if s.Name == identifier || s.Commit == identifier {
+			return &s, nil
+		}
+		if strings.Contains(s.Name, identifier) || isCommitPrefix(s.Commit, identifier) {
+			candidates = append(candidates, s)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("snapshot not found: %s", identifier)
+	case 1:
+		return &candidates[0], nil
+	}
+
+	names := make([]string, len(candidates))
+	for i, s := range candidates {
+		names[i] = s.Name
+	}
+	return nil, &AmbiguousSnapshotError{Identifier: identifier, Candidates: names}
+}
+
+func isCommitPrefix(commit, prefix string) bool {
+	return commit != "" && len(prefix) >= 4 && strings.HasPrefix(commit, strings.ToLower(prefix))
+}
+
+func pluralSnapshots(n int) string {
+	if n == 1 {
+		return "snapshot"
+	}
+	return "snapshots"
+}
+
+// beforeFormats are the layouts accepted by ParseBefore, in local time.
+var beforeFormats = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	TimestampFormat,
+}
+
+// ParseBefore parses a point in time given as a date, a date and time, or
+// RFC 3339, e.g. "2026-10-01" or "2026-10-01 14:30". Dates without a zone
+// are local time.
+func ParseBefore(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range beforeFormats {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected e.g. 2026-10-01 or \"2026-10-01 14:30\")", value)
+}
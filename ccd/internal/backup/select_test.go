@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLegacySnapshot stores an empty snapshot under a pre-ID name.
+func writeLegacySnapshot(t *testing.T, backupDir string, timestamp time.Time) string {
+	t.Helper()
+	name := SnapshotPrefix + timestamp.Format(TimestampFormat) + SnapshotSuffix
+	if err := os.WriteFile(filepath.Join(backupDir, name), nil, 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	return name
+}
+
+func TestCreateSnapshot_SameSecondNamesAreUnique(t *testing.T) {
+	targetDir := t.TempDir()
+	store := NewLocalStore(t.TempDir())
+
+	writeFile(t, targetDir, "CLAUDE.md", "content")
+
+	var names []string
+	for _, label := range []string{"first", "second", "third"} {
+		snapshot, err := CreateSnapshot(SnapshotOptions{TargetDir: targetDir, Store: store, Metadata: Metadata{Label: label}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, snapshot.Name)
+	}
+
+	snapshots, err := ListSnapshots(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(snapshots))
+	}
+	// Newest first, even within the same second
+	for i, want := range []string{"third", "second", "first"} {
+		if snapshots[i].Metadata.Label != want {
+			t.Errorf("snapshot %d: expected %s, got %s", i, want, snapshots[i].Metadata.Label)
+		}
+	}
+
+	id := strings.TrimSuffix(names[1][strings.LastIndex(names[1], "_")+1:], SnapshotSuffix)
+	snapshot, err := FindSnapshot(store, id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Name != names[1] {
+		t.Errorf("expected %s by id, got %s", names[1], snapshot.Name)
+	}
+}
+
+func TestSelectSnapshot(t *testing.T) {
+	backupDir := t.TempDir()
+	store := NewLocalStore(backupDir)
+
+	oct := writeLegacySnapshot(t, backupDir, time.Date(2026, 10, 2, 9, 0, 0, 0, time.Local))
+	sep := writeLegacySnapshot(t, backupDir, time.Date(2026, 9, 30, 18, 0, 0, 0, time.Local))
+	aug := writeLegacySnapshot(t, backupDir, time.Date(2026, 8, 15, 12, 0, 0, 0, time.Local))
+
+	before, err := ParseBefore("2026-10-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		identifier string
+		filter     SnapshotFilter
+		want       string
+	}{
+		{"", SnapshotFilter{}, oct},
+		{"@0", SnapshotFilter{}, oct},
+		{"@1", SnapshotFilter{}, sep},
+		{"@2", SnapshotFilter{}, aug},
+		{"2026-09", SnapshotFilter{}, sep},
+		{aug, SnapshotFilter{}, aug},
+		{"", SnapshotFilter{Before: before}, sep},
+		{"@1", SnapshotFilter{Before: before}, aug},
+	}
+
+	for _, tt := range tests {
+		snapshot, err := SelectSnapshot(store, tt.identifier, tt.filter)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.identifier, err)
+			continue
+		}
+		if snapshot.Name != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.identifier, tt.want, snapshot.Name)
+		}
+	}
+
+	for _, identifier := range []string{"@3", "@x", "2025"} {
+		if _, err := FindSnapshot(store, identifier); err == nil {
+			t.Errorf("%q: expected error", identifier)
+		}
+	}
+}
+
+func TestFindSnapshot_AmbiguousListsCandidates(t *testing.T) {
+	backupDir := t.TempDir()
+
+	first := writeLegacySnapshot(t, backupDir, time.Date(2026, 10, 2, 9, 0, 0, 0, time.Local))
+	second := writeLegacySnapshot(t, backupDir, time.Date(2026, 10, 5, 9, 0, 0, 0, time.Local))
+	writeLegacySnapshot(t, backupDir, time.Date(2026, 9, 5, 9, 0, 0, 0, time.Local))
+
+	_, err := FindSnapshot(NewLocalStore(backupDir), "2026-10")
+
+	var ambiguous *AmbiguousSnapshotError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("expected AmbiguousSnapshotError, got %v", err)
+	}
+	if len(ambiguous.Candidates) != 2 || ambiguous.Candidates[0] != second || ambiguous.Candidates[1] != first {
+		t.Errorf("unexpected candidates: %v", ambiguous.Candidates)
+	}
+	if !strings.Contains(err.Error(), first) || !strings.Contains(err.Error(), second) {
+		t.Errorf("expected error to list candidates, got %q", err)
+	}
+}
+
+func TestParseBefore(t *testing.T) {
+	tests := map[string]time.Time{
+		"2026-10-01":           time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local),
+		"2026-10-01 14:30":     time.Date(2026, 10, 1, 14, 30, 0, 0, time.Local),
+		"2026-10-01T14:30:05":  time.Date(2026, 10, 1, 14, 30, 5, 0, time.Local),
+		"2026-10-01_14-30-05":  time.Date(2026, 10, 1, 14, 30, 5, 0, time.Local),
+		"2026-10-01T14:30:05Z": time.Date(2026, 10, 1, 14, 30, 5, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := ParseBefore(value)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", value, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%q: expected %v, got %v", value, want, got)
+		}
+	}
+
+	if _, err := ParseBefore("last tuesday"); err == nil {
+		t.Error("expected error for unparseable time")
+	}
+}
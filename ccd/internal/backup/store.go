@@ -0,0 +1,214 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+// DefaultStoreName refers to the local backup.dir store.
+const DefaultStoreName = "local"
+
+// Values of backup.backend.
+const (
+	BackendArchive = "archive"
+	BackendGit     = "git"
+)
+
+// Store persists snapshot files by name.
+type Store interface {
+	// Put stores the content read from r under name. It fails rather than
+	// overwrite an existing object.
+	Put(name string, r io.Reader) error
+	// List returns the stored objects in no particular order.
+	List() ([]ObjectInfo, error)
+	// Open returns the content of a stored object.
+	Open(name string) (Object, error)
+	// Delete removes a stored object.
+	Delete(name string) error
+	// Sub returns the store for a namespace nested in this one. Objects in
+	// nested namespaces are not listed by the parent.
+	Sub(namespace string) Store
+	// String describes the store location for display.
+	String() string
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Name string
+	Size int64
+	// Commit is the commit holding the object in a GitStore.
+	Commit string
+	// Manifest carries the snapshot's timestamp, target and metadata when
+	// the store lists them, so the snapshot need not be opened; its Files
+	// are not set.
+	Manifest *BackupManifest
+}
+
+// Object is random-access content read from a store.
+type Object interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// StoreFromConfig returns the named store from the backup config. An empty
+// name selects backup.store, which defaults to the local backup.dir, or to
+// its git repository with backup.backend set to git.
+func StoreFromConfig(cfg config.BackupConfig, name string) (Store, error) {
+	switch cfg.Backend {
+	case "", BackendArchive:
+	case BackendGit:
+		if name == "" {
+			if cfg.Encryption.Enabled {
+				return nil, fmt.Errorf("backup encryption is not supported with the git backend")
+			}
+			return NewGitStore(filepath.Join(cfg.Dir, GitRepoName)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown backup backend %q (expected archive or git)", cfg.Backend)
+	}
+
+	if name == "" {
+		name = cfg.Store
+	}
+	if name == "" {
+		name = DefaultStoreName
+	}
+
+	sc, ok := cfg.Stores[name]
+	if !ok {
+		if name == DefaultStoreName {
+			return NewLocalStore(cfg.Dir), nil
+		}
+		return nil, fmt.Errorf("unknown backup store %q", name)
+	}
+
+	switch sc.Type {
+	case "", "local":
+		if sc.Dir == "" {
+			return nil, fmt.Errorf("backup store %q: dir is required", name)
+		}
+		return NewLocalStore(config.ExpandPath(sc.Dir)), nil
+	case "s3":
+		opts := S3Options{
+			Endpoint:  sc.Endpoint,
+			Region:    sc.Region,
+			Bucket:    sc.Bucket,
+			Prefix:    sc.Prefix,
+			AccessKey: sc.AccessKey,
+			SecretKey: sc.SecretKey,
+		}
+		if opts.AccessKey == "" {
+			opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if opts.SecretKey == "" {
+			opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		store, err := NewS3Store(opts)
+		if err != nil {
+			return nil, fmt.Errorf("backup store %q: %w", name, err)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("backup store %q: unknown type %q (expected local or s3)", name, sc.Type)
+	}
+}
+
+// LocalStore keeps snapshots as files in a directory.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{Dir: dir}
+}
+
+func (s *LocalStore) String() string {
+	return s.Dir
+}
+
+// Put writes the content to a temporary file first and links it into place,
+// so a snapshot is either complete or absent and is never overwritten.
+func (s *LocalStore) Put(name string, r io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-"+name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+func (s *LocalStore) List() ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var objects []ObjectInfo
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Name: entry.Name(), Size: info.Size()})
+	}
+	return objects, nil
+}
+
+func (s *LocalStore) Open(name string) (Object, error) {
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileObject{File: f, size: info.Size()}, nil
+}
+
+func (s *LocalStore) Delete(name string) error {
+	return os.Remove(filepath.Join(s.Dir, name))
+}
+
+func (s *LocalStore) Sub(namespace string) Store {
+	return NewLocalStore(filepath.Join(s.Dir, namespace))
+}
+
+type fileObject struct {
+	*os.File
+	size int64
+}
+
+func (o *fileObject) Size() int64 {
+	return o.size
+}
@@ -4,30 +4,91 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 type BackupConfig struct {
 	Enabled      bool   `yaml:"enabled"`
 	Dir          string `yaml:"dir"`
 	MaxSnapshots int    `yaml:"max_snapshots"`
+
+	// Backend is "archive" (snapshot files in a store) or "git" (commits
+	// in a repository under Dir)
+	Backend string `yaml:"backend" enum:"archive,git"`
+
+	// Retention rules; keep_last falls back to max_snapshots when unset
+	KeepLast     int    `yaml:"keep_last"`
+	KeepDaily    int    `yaml:"keep_daily"`
+	KeepWeekly   int    `yaml:"keep_weekly"`
+	KeepMonthly  int    `yaml:"keep_monthly"`
+	MaxAge       string `yaml:"max_age" unit:"age"`
+	MaxTotalSize string `yaml:"max_total_size" unit:"size"`
+
+	// Unmapped target paths to capture in every snapshot
+	ExtraPaths []string `yaml:"extra_paths"`
+
+	// Store names the store snapshots are written to; empty means the
+	// local Dir. Stores defines additional named stores.
+	Store  string                 `yaml:"store"`
+	Stores map[string]StoreConfig `yaml:"stores"`
+
+	Encryption EncryptionConfig `yaml:"encryption"`
+
+	// Archive format of new snapshots (zip, tar.gz or tar.zst) and its
+	// compression level; 0 selects the format's default level
+	Format           string `yaml:"format" enum:"zip,tar.gz,tar.zst"`
+	CompressionLevel int    `yaml:"compression_level"`
+}
+
+// MaxCompressionLevel returns the highest compression level of a backup
+// format: 22 for tar.zst and 9 for the others.
+func MaxCompressionLevel(format string) int {
+	if format == "tar.zst" {
+		return 22
+	}
+	return 9
+}
+
+// EncryptionConfig enables encrypted snapshots. With KeyFile unset the key
+// is derived from a passphrase.
+type EncryptionConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// StoreConfig describes a named snapshot store. Type "local" keeps
+// snapshots in Dir; type "s3" uses an S3-compatible bucket.
+type StoreConfig struct {
+	Type      string `yaml:"type" enum:"local,s3"`
+	Dir       string `yaml:"dir"`
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
 }
 
 type Config struct {
-	Source          string       `yaml:"source"`
-	Target          string       `yaml:"target"`
-	Mappings        []Mapping    `yaml:"mappings"`
-	IgnorePatterns  []string     `yaml:"ignore_patterns"`
-	Backup          BackupConfig `yaml:"backup"`
-	DefaultMode     string       `yaml:"default_mode"`
-	ConfirmDeletes  bool         `yaml:"confirm_deletes"`
+	// Version is the schema version of the file; see Migrate
+	Version int `yaml:"version"`
+
+	Source         string       `yaml:"source"`
+	Target         string       `yaml:"target"`
+	Mappings       []Mapping    `yaml:"mappings"`
+	IgnorePatterns []string     `yaml:"ignore_patterns"`
+	Backup         BackupConfig `yaml:"backup"`
+	DefaultMode    string       `yaml:"default_mode" enum:"merge,sync"`
+	ConfirmDeletes bool         `yaml:"confirm_deletes"`
+
+	// Exclude is the legacy name of IgnorePatterns; Load appends it there
+	Exclude []string `yaml:"exclude,omitempty" deprecated:"ignore_patterns"`
 }
 
 func Default() *Config {
 	return &Config{
-		Source: "claude-files",
-		Target: "~/.claude",
+		Version: CurrentVersion,
+		Source:  "claude-files",
+		Target:  "~/.claude",
 		IgnorePatterns: []string{
 			".DS_Store",
 			"Thumbs.db",
@@ -42,6 +103,8 @@ func Default() *Config {
 			Enabled:      true,
 			Dir:          "~/.claude-backups",
 			MaxSnapshots: 5,
+			Backend:      "archive",
+			Format:       "zip",
 		},
 		DefaultMode:    "merge",
 		ConfirmDeletes: true,
@@ -59,45 +122,13 @@ func ExpandPath(path string) string {
 	return path
 }
 
-func Load(execPath string) (*Config, error) {
-	cfg := Default()
-
-	locations := []string{
-		filepath.Join(filepath.Dir(execPath), "config.yaml"),
-		ExpandPath("~/.config/claude-deploy/config.yaml"),
-		ExpandPath("~/.claude-deploy/config.yaml"),
-	}
-
-	var configPath string
-	for _, loc := range locations {
-		if _, err := os.Stat(loc); err == nil {
-			configPath = loc
-			break
-		}
-	}
-
-	if configPath == "" {
-		cfg.Target = ExpandPath(cfg.Target)
-		cfg.Backup.Dir = ExpandPath(cfg.Backup.Dir)
-		return cfg, nil
-	}
-
-	data, err := os.ReadFile(configPath)
+// Load resolves the config for execPath from every layer, with overrides
+// from command line flags on top; see Resolve.
+func Load(execPath string, overrides ...Override) (*Config, error) {
+	workDir, _ := os.Getwd()
+	r, err := Resolve(execPath, workDir, overrides)
 	if err != nil {
 		return nil, err
 	}
-
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, err
-	}
-
-	cfg.Target = ExpandPath(cfg.Target)
-	cfg.Backup.Dir = ExpandPath(cfg.Backup.Dir)
-
-	// Ensure Source has a default if not specified
-	if cfg.Source == "" {
-		cfg.Source = "claude-files"
-	}
-
-	return cfg, nil
+	return r.Config, nil
 }
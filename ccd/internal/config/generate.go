@@ -1,6 +1,12 @@
 package config
 
-import "path/filepath"
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
 
 // GenerateDefault returns a YAML string containing the default configuration
 // with comprehensive comments explaining each option.
@@ -13,6 +19,9 @@ func GenerateDefault() string {
 # - ~/.config/claude-deploy/config.yaml
 # - ~/.claude-deploy/config.yaml
 
+# Config schema version; ccd config migrate upgrades older files
+version: 2
+
 # Source directory containing files to deploy
 # Relative to working directory
 source: claude-files
@@ -54,8 +63,82 @@ backup:
   dir: ~/.claude-backups
 
   # Maximum number of snapshots to keep (oldest pruned first)
+  # Used as keep_last when keep_last is not set
   max_snapshots: 5
 
+  # Time-based retention (grandfather-father-son)
+  # A snapshot survives pruning if any rule keeps it; 0 disables a rule.
+  # - keep_last: the newest N snapshots
+  # - keep_daily/weekly/monthly: the newest snapshot of each of the
+  #   last N days/weeks/months that have snapshots
+  keep_daily: 0
+  keep_weekly: 0
+  keep_monthly: 0
+
+  # Hard limits applied after the keep rules (empty disables)
+  # - max_age: remove snapshots older than this (e.g. 36h, 30d, 12w)
+  # - max_total_size: drop the oldest snapshots beyond this total (e.g. 500MB)
+  # The most recent snapshot is never pruned.
+  max_age: ""
+  max_total_size: ""
+
+  # Preview what pruning would do: ccd backup prune --dry-run
+
+  # How snapshots are kept
+  # - archive: one snapshot file per backup in the store below
+  # - git: one commit per backup in <dir>/history.git, with a message
+  #   describing the deploy or rollback. Browse it with git log, and roll
+  #   back to a commit with: ccd rollback <commit>
+  #   Commits are never pruned; encryption and stores do not apply.
+  backend: archive
+
+  # Unmapped target paths to include in every snapshot, relative to the
+  # target or absolute within it. Useful for irreplaceable files ccd does
+  # not manage. They are only restored with: ccd rollback --include-extra
+  extra_paths: []
+  #  - settings.json
+  #  - projects/
+
+  # Where snapshots are written: "local" (the dir above) or the name of a
+  # store defined under stores. Restore from any store with:
+  #   ccd rollback --store <name>
+  store: local
+
+  # Additional snapshot stores
+  # - type: local  keeps snapshots in dir
+  # - type: s3     uses an S3-compatible bucket (AWS S3, MinIO, ...)
+  #   Credentials default to AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY.
+  stores: {}
+  #  team:
+  #    type: s3
+  #    endpoint: https://minio.example.com
+  #    region: us-east-1
+  #    bucket: claude-backups
+  #    prefix: alice/
+
+  # Encrypt snapshots (AES-256-GCM). Contents and manifest are encrypted;
+  # reason, label and other metadata stay readable so snapshots can be
+  # listed without the key.
+  # - key_file: file with at least 16 random bytes, e.g.
+  #     head -c 32 /dev/urandom > ~/.config/claude-deploy/backup.key
+  # - without key_file a passphrase is read from CCD_BACKUP_PASSPHRASE or
+  #   prompted for. Losing the key or passphrase makes snapshots unusable.
+  # Check a snapshot with: ccd backup verify
+  encryption:
+    enabled: false
+    key_file: ""
+
+  # Archive format of new snapshots
+  # - zip: deflate zip, readable by any unzip tool
+  # - tar.gz: gzip-compressed tar
+  # - tar.zst: zstd-compressed tar, usually fastest and smallest
+  # Existing snapshots are read whatever their format.
+  format: zip
+
+  # Compression level: 1-9 for zip and tar.gz, 1-22 for tar.zst
+  # (higher is smaller but slower); 0 uses the format's default
+  compression_level: 0
+
 # Default sync mode
 # - "merge": Add and update files only (safe)
 # - "sync": Also delete files not in source (destructive)
@@ -66,6 +149,78 @@ confirm_deletes: true
 `
 }
 
+// GeneratedDefaults returns the settings of GenerateDefault, the starting
+// point for Generate.
+func GeneratedDefaults() *Config {
+	cfg := Default()
+	if err := yaml.Unmarshal([]byte(GenerateDefault()), cfg); err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// Generate returns the configuration of GenerateDefault with the settings
+// of cfg. Keys keep their comments; values that cfg does not change keep
+// their formatting.
+func Generate(cfg *Config) (string, error) {
+	data := []byte(GenerateDefault())
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	spaced := spacedKeys(&doc, data)
+
+	if err := setValues(doc.Content[0], reflect.ValueOf(*cfg), reflect.ValueOf(*GeneratedDefaults())); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", err
+	}
+	enc.Close()
+
+	out, err := restoreBlankLines(&doc, buf.Bytes(), spaced)
+	if err != nil {
+		return "", err
+	}
+	return string(restoreCommentSpacing(out, data)), nil
+}
+
+// setValues replaces the values of node where v differs from defaults,
+// the settings node was decoded into.
+func setValues(node *yaml.Node, v, defaults reflect.Value) error {
+	fields := yamlFields(v.Type())
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		field, ok := fields[node.Content[i].Value]
+		if !ok {
+			continue
+		}
+		value, def := v.FieldByIndex(field.Index), defaults.FieldByIndex(field.Index)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := setValues(node.Content[i+1], value, def); err != nil {
+				return err
+			}
+			continue
+		}
+		if sameValue(value, def) {
+			continue
+		}
+
+		var encoded yaml.Node
+		if err := encoded.Encode(value.Interface()); err != nil {
+			return err
+		}
+		encoded.LineComment = node.Content[i+1].LineComment
+		encoded.FootComment = node.Content[i+1].FootComment
+		node.Content[i+1] = &encoded
+	}
+	return nil
+}
+
 // GetConfigOutputPath returns the path where config.yaml should be written.
 // This is always next to the executable.
 func GetConfigOutputPath(execPath string) string {
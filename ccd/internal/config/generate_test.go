@@ -143,3 +143,46 @@ func TestGetConfigOutputPath_ReturnsAbsolutePath(t *testing.T) {
 		t.Errorf("GetConfigOutputPath() returned non-absolute path: %q", got)
 	}
 }
+
+func TestGenerate_Unchanged(t *testing.T) {
+	got, err := Generate(GeneratedDefaults())
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if want := GenerateDefault(); got != want {
+		t.Errorf("Generate(GeneratedDefaults()) differs from GenerateDefault():\n%s", got)
+	}
+}
+
+func TestGenerate_Settings(t *testing.T) {
+	cfg := GeneratedDefaults()
+	cfg.Target = "/srv/claude"
+	cfg.Mappings = []Mapping{{Source: "agents/", Target: "agents/"}}
+	cfg.Backup.Enabled = false
+	cfg.DefaultMode = "sync"
+
+	got, err := Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	decoded := Default()
+	if _, err := Decode("config.yaml", []byte(got), decoded); err != nil {
+		t.Fatalf("generated config does not decode: %v", err)
+	}
+	if decoded.Target != "/srv/claude" || decoded.Backup.Enabled || decoded.DefaultMode != "sync" ||
+		len(decoded.Mappings) != 1 || decoded.Mappings[0].Source != "agents/" {
+		t.Errorf("decoded config = %+v", *decoded)
+	}
+
+	for _, want := range []string{
+		"# Target directory for deployment\n# Supports ~ for home directory\ntarget: /srv/claude\n",
+		"mappings:\n  - source: agents/\n    target: agents/\n\n# Glob patterns",
+		"  - \"*.tmp\"\n",
+		"  max_total_size: \"\"\n\n  # Preview what pruning would do",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Generate() output missing %q", want)
+		}
+	}
+}
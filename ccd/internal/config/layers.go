@@ -0,0 +1,374 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config layers, lowest precedence first. Each layer overrides the keys
+// it sets and keeps the rest.
+const (
+	LayerDefault    = "default"    // built into ccd
+	LayerSystem     = "system"     // SystemConfigPath
+	LayerUser       = "user"       // ~/.config/claude-deploy/config.yaml
+	LayerExecutable = "executable" // config.yaml next to the ccd binary
+	LayerRepo       = "repo"       // RepoConfigName in the working tree
+	LayerEnv        = "env"        // EnvPrefix variables
+	LayerFlag       = "flag"       // command line flags
+)
+
+// SystemConfigPath is the config file shared by every user.
+var SystemConfigPath = "/etc/claude-deploy/config.yaml"
+
+// RepoConfigName is the repo-local config file, looked for in the working
+// directory and its parents up to the root of the git repository.
+const RepoConfigName = ".ccd.yaml"
+
+// EnvPrefix starts the environment variables that set config keys: the
+// dotted key in upper case with dots as underscores, e.g.
+// CCD_BACKUP_MAX_SNAPSHOTS. Lists are comma-separated.
+const EnvPrefix = "CCD_"
+
+// File is a config file and the layer it belongs to.
+type File struct {
+	Layer string
+	Path  string
+}
+
+// Origin tells where the value of a key came from.
+type Origin struct {
+	Layer string
+	// Source is the file and line, environment variable or flag that set
+	// the value; empty for defaults.
+	Source string
+}
+
+func (o Origin) String() string {
+	if o.Source == "" {
+		return o.Layer
+	}
+	return fmt.Sprintf("%s (%s)", o.Layer, o.Source)
+}
+
+// Override sets a key from a command line flag.
+type Override struct {
+	Key   string
+	Value string
+	Flag  string
+}
+
+// Resolved is the config merged from every layer.
+type Resolved struct {
+	*Config
+	// Files are the config files read, lowest precedence first.
+	Files []File
+	// Origins maps dotted keys to the layer that set them; keys without an
+	// entry have their default value.
+	Origins map[string]Origin
+}
+
+// Origin returns where the value of key came from.
+func (r *Resolved) Origin(key string) Origin {
+	if o, ok := r.Origins[key]; ok {
+		return o
+	}
+	return Origin{Layer: LayerDefault}
+}
+
+// Files returns the config files that exist for execPath and workDir,
+// lowest precedence first.
+func Files(execPath, workDir string) []File {
+	var files []File
+	add := func(layer, path string) bool {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, File{Layer: layer, Path: path})
+			return true
+		}
+		return false
+	}
+
+	add(LayerSystem, SystemConfigPath)
+	// The legacy location is only read without the current one
+	if !add(LayerUser, ExpandPath("~/.config/claude-deploy/config.yaml")) {
+		add(LayerUser, ExpandPath("~/.claude-deploy/config.yaml"))
+	}
+	// Before layering, the config next to the binary won over the user's
+	add(LayerExecutable, GetConfigOutputPath(execPath))
+
+	if workDir != "" {
+		for dir := workDir; ; dir = filepath.Dir(dir) {
+			if add(LayerRepo, filepath.Join(dir, RepoConfigName)) {
+				break
+			}
+			if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	return files
+}
+
+// Resolve merges the defaults, the config files, the environment and
+// overrides, in that order. Every file is decoded strictly, see Decode.
+func Resolve(execPath, workDir string, overrides []Override) (*Resolved, error) {
+	r := &Resolved{Config: Default(), Origins: make(map[string]Origin)}
+
+	for _, f := range Files(execPath, workDir) {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := Decode(f.Path, data, r.Config); err != nil {
+			return nil, err
+		}
+		r.Files = append(r.Files, f)
+
+		for key, line := range keyLines(data) {
+			r.Origins[key] = Origin{Layer: f.Layer, Source: fmt.Sprintf("%s:%d", f.Path, line)}
+		}
+	}
+
+	envKeys := EnvKeys()
+	names := make([]string, 0, len(envKeys))
+	for name := range envKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := r.Config.set(envKeys[name], value, name); err != nil {
+			return nil, err
+		}
+		r.Origins[envKeys[name]] = Origin{Layer: LayerEnv, Source: name}
+	}
+
+	for _, o := range overrides {
+		if err := r.Config.set(o.Key, o.Value, o.Flag); err != nil {
+			return nil, err
+		}
+		r.Origins[o.Key] = Origin{Layer: LayerFlag, Source: o.Flag}
+	}
+
+	r.Target = ExpandPath(r.Target)
+	r.Backup.Dir = ExpandPath(r.Backup.Dir)
+	if r.Source == "" {
+		r.Source = "claude-files"
+	}
+
+	return r, nil
+}
+
+// EnvKeys maps the environment variables that can set config keys to
+// those keys. Only single values and lists of strings can be set.
+func EnvKeys() map[string]string {
+	keys := make(map[string]string)
+	leafKeys(reflect.TypeOf(Config{}), "", nil, func(key string, field reflect.StructField, _ []int) {
+		kind := field.Type.Kind()
+		if key == "version" || field.Tag.Get("deprecated") != "" || kind == reflect.Map ||
+			(kind == reflect.Slice && field.Type.Elem().Kind() != reflect.String) {
+			return
+		}
+		keys[EnvPrefix+strings.ToUpper(strings.ReplaceAll(key, ".", "_"))] = key
+	})
+	return keys
+}
+
+// leafKeys calls fn for every key of t that is not a nested section,
+// with the index sequence of its field for reflect.Value.FieldByIndex.
+func leafKeys(t reflect.Type, path string, index []int, fn func(key string, field reflect.StructField, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		key := joinKey(path, name)
+		fieldIndex := append(append([]int(nil), index...), i)
+		if f.Type.Kind() == reflect.Struct {
+			leafKeys(f.Type, key, fieldIndex, fn)
+			continue
+		}
+		fn(key, f, fieldIndex)
+	}
+}
+
+// Setting is the effective value of a config key.
+type Setting struct {
+	Key    string
+	Value  any
+	Origin Origin
+}
+
+// Masked stands in for credentials in Settings and Annotated.
+const Masked = "****"
+
+// masked returns a copy of the config for display, with the credentials
+// of backup stores replaced by Masked.
+func (c *Config) masked() *Config {
+	out := *c
+	if c.Backup.Stores != nil {
+		out.Backup.Stores = make(map[string]StoreConfig, len(c.Backup.Stores))
+		for name, sc := range c.Backup.Stores {
+			if sc.AccessKey != "" {
+				sc.AccessKey = Masked
+			}
+			if sc.SecretKey != "" {
+				sc.SecretKey = Masked
+			}
+			out.Backup.Stores[name] = sc
+		}
+	}
+	return &out
+}
+
+// Settings lists the effective value of every key, in the order of the
+// generated config. Credentials are masked.
+func (r *Resolved) Settings() []Setting {
+	var settings []Setting
+	v := reflect.ValueOf(r.Config.masked()).Elem()
+	leafKeys(v.Type(), "", nil, func(key string, field reflect.StructField, index []int) {
+		if field.Tag.Get("deprecated") == "" {
+			settings = append(settings, Setting{Key: key, Value: v.FieldByIndex(index).Interface(), Origin: r.Origin(key)})
+		}
+	})
+	return settings
+}
+
+// Annotated renders the resolved config as YAML, with a comment after
+// each value naming its origin. Credentials are masked.
+func (r *Resolved) Annotated() ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(r.Config.masked()); err != nil {
+		return nil, err
+	}
+
+	var annotate func(node *yaml.Node, t reflect.Type, path string)
+	annotate = func(node *yaml.Node, t reflect.Type, path string) {
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				continue
+			}
+			keyPath := joinKey(path, key.Value)
+			if field.Type.Kind() == reflect.Struct {
+				annotate(value, field.Type, keyPath)
+				continue
+			}
+
+			comment := "# " + r.Origin(keyPath).String()
+			if value.Kind == yaml.ScalarNode || len(value.Content) == 0 {
+				value.LineComment = comment
+			} else {
+				key.LineComment = comment
+			}
+		}
+	}
+	annotate(&doc, reflect.TypeOf(Config{}), "")
+
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	return []byte(buf.String()), nil
+}
+
+// set decodes value into the key it names, with the checks of Decode.
+// Lists are comma-separated. source names the value in errors.
+func (c *Config) set(key, value, source string) error {
+	v := reflect.ValueOf(c).Elem()
+	var field reflect.StructField
+	for _, name := range strings.Split(key, ".") {
+		f, ok := yamlFields(v.Type())[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown config key %q", source, key)
+		}
+		field, v = f, v.FieldByIndex(f.Index)
+		if f.Type.Kind() != reflect.Struct {
+			break
+		}
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if field.Type.Kind() == reflect.Slice {
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+			}
+		}
+	}
+
+	val := &validator{file: source}
+	val.checkField(field, node, key)
+	if len(val.errors) > 0 {
+		return &ValidationError{Issues: val.errors}
+	}
+
+	decoded := reflect.New(field.Type)
+	if err := node.Decode(decoded.Interface()); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	v.Set(decoded.Elem())
+
+	if key == "backup.compression_level" {
+		if err := compressionLevel(c.Backup.Format, c.Backup.CompressionLevel); err != nil {
+			return &ValidationError{Issues: []Issue{{File: source, Key: key, Message: err.Error()}}}
+		}
+	}
+	return nil
+}
+
+// keyLines returns the line of each key a config file sets, by dotted
+// key. Sections are descended into; any other value counts as one key.
+// Deprecated keys are reported as their replacement.
+func keyLines(data []byte) map[string]int {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	lines := make(map[string]int)
+	var walk func(node *yaml.Node, t reflect.Type, path string)
+	walk = func(node *yaml.Node, t reflect.Type, path string) {
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				continue
+			}
+			name := key.Value
+			if replacement := field.Tag.Get("deprecated"); replacement != "" {
+				name = replacement
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(value, field.Type, joinKey(path, name))
+				continue
+			}
+			lines[joinKey(path, name)] = key.Line
+		}
+	}
+	walk(doc.Content[0], reflect.TypeOf(Config{}), "")
+	return lines
+}
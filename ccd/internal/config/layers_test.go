@@ -0,0 +1,237 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// layerDirs isolates the config layers in a temp dir: the system file,
+// HOME, and an executable and working tree of their own. It returns the
+// executable path and the working directory.
+func layerDirs(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+
+	system := SystemConfigPath
+	SystemConfigPath = filepath.Join(root, "etc", "config.yaml")
+	t.Cleanup(func() { SystemConfigPath = system })
+	t.Setenv("HOME", filepath.Join(root, "home"))
+
+	workDir := filepath.Join(root, "repo", "sub")
+	for _, dir := range []string{filepath.Join(root, "bin"), filepath.Join(root, "repo", ".git"), workDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(root, "bin", "ccd"), workDir
+}
+
+func writeLayer(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve_Precedence(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	home := os.Getenv("HOME")
+	repoConfig := filepath.Join(filepath.Dir(workDir), RepoConfigName)
+
+	execConfig := filepath.Join(filepath.Dir(execPath), "config.yaml")
+
+	writeLayer(t, SystemConfigPath, "target: /system\ndefault_mode: sync\nbackup:\n  max_snapshots: 9\n")
+	writeLayer(t, filepath.Join(home, ".config", "claude-deploy", "config.yaml"), "target: /user\nsource: dotfiles\nconfirm_deletes: false\n")
+	writeLayer(t, execConfig, "target: /exec\nconfirm_deletes: true\n")
+	writeLayer(t, repoConfig, "target: /repo\nbackup:\n  enabled: false\n")
+
+	r, err := Resolve(execPath, workDir, nil)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	var layers []string
+	for _, f := range r.Files {
+		layers = append(layers, f.Layer)
+	}
+	if want := []string{LayerSystem, LayerUser, LayerExecutable, LayerRepo}; !reflect.DeepEqual(layers, want) {
+		t.Errorf("layers = %v, want %v", layers, want)
+	}
+
+	if r.Target != "/repo" || r.Source != "dotfiles" || r.DefaultMode != "sync" ||
+		r.Backup.MaxSnapshots != 9 || r.Backup.Enabled || !r.ConfirmDeletes {
+		t.Errorf("merged config = %+v", *r.Config)
+	}
+	if got := r.Backup.Format; got != "zip" {
+		t.Errorf("backup.format = %q, want the default", got)
+	}
+
+	tests := map[string]Origin{
+		"target":               {Layer: LayerRepo, Source: repoConfig + ":1"},
+		"source":               {Layer: LayerUser, Source: filepath.Join(home, ".config", "claude-deploy", "config.yaml") + ":2"},
+		"backup.max_snapshots": {Layer: LayerSystem, Source: SystemConfigPath + ":4"},
+		"backup.enabled":       {Layer: LayerRepo, Source: repoConfig + ":3"},
+		"confirm_deletes":      {Layer: LayerExecutable, Source: execConfig + ":2"},
+		"backup.format":        {Layer: LayerDefault},
+	}
+	for key, want := range tests {
+		if got := r.Origin(key); got != want {
+			t.Errorf("Origin(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestResolve_EnvAndOverrides(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	writeLayer(t, filepath.Join(filepath.Dir(execPath), "config.yaml"), "target: /exec\nconfirm_deletes: true\n")
+
+	t.Setenv("CCD_TARGET", "/env")
+	t.Setenv("CCD_CONFIRM_DELETES", "false")
+	t.Setenv("CCD_IGNORE_PATTERNS", "*.bak, node_modules")
+
+	r, err := Resolve(execPath, workDir, []Override{{Key: "target", Value: "/flag", Flag: "--target"}})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if r.Target != "/flag" {
+		t.Errorf("target = %q, want /flag", r.Target)
+	}
+	if r.ConfirmDeletes {
+		t.Error("confirm_deletes = true, want false from the environment")
+	}
+	if want := []string{"*.bak", "node_modules"}; !reflect.DeepEqual(r.IgnorePatterns, want) {
+		t.Errorf("ignore_patterns = %v, want %v", r.IgnorePatterns, want)
+	}
+
+	if got, want := r.Origin("target"), (Origin{Layer: LayerFlag, Source: "--target"}); got != want {
+		t.Errorf("Origin(target) = %v, want %v", got, want)
+	}
+	if got, want := r.Origin("confirm_deletes"), (Origin{Layer: LayerEnv, Source: "CCD_CONFIRM_DELETES"}); got != want {
+		t.Errorf("Origin(confirm_deletes) = %v, want %v", got, want)
+	}
+}
+
+func TestResolve_InvalidEnv(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	t.Setenv("CCD_DEFAULT_MODE", "mirror")
+
+	_, err := Resolve(execPath, workDir, nil)
+	if err == nil || !strings.Contains(err.Error(), `CCD_DEFAULT_MODE: default_mode: "mirror" is not one of merge, sync`) {
+		t.Errorf("Resolve() error = %v", err)
+	}
+
+	t.Setenv("CCD_DEFAULT_MODE", "sync")
+	t.Setenv("CCD_BACKUP_MAX_AGE", "a month")
+	_, err = Resolve(execPath, workDir, nil)
+	if err == nil || !strings.Contains(err.Error(), `CCD_BACKUP_MAX_AGE: backup.max_age: invalid age "a month"`) {
+		t.Errorf("Resolve() error = %v", err)
+	}
+
+	t.Setenv("CCD_BACKUP_MAX_AGE", "30d")
+	t.Setenv("CCD_BACKUP_COMPRESSION_LEVEL", "30")
+	_, err = Resolve(execPath, workDir, nil)
+	if err == nil || !strings.Contains(err.Error(), "CCD_BACKUP_COMPRESSION_LEVEL: backup.compression_level: 30 is out of range for zip") {
+		t.Errorf("Resolve() error = %v", err)
+	}
+}
+
+func TestFiles_RepoLookup(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	repo := filepath.Dir(workDir)
+
+	// Config files above the repository root are not repo-local
+	writeLayer(t, filepath.Join(filepath.Dir(repo), RepoConfigName), "target: /outside\n")
+	if files := Files(execPath, workDir); len(files) != 0 {
+		t.Errorf("Files() = %v, want none", files)
+	}
+
+	writeLayer(t, filepath.Join(repo, RepoConfigName), "target: /repo\n")
+	files := Files(execPath, workDir)
+	if len(files) != 1 || files[0].Path != filepath.Join(repo, RepoConfigName) {
+		t.Errorf("Files() = %v, want the repo config", files)
+	}
+}
+
+func TestResolved_Annotated(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	t.Setenv("CCD_BACKUP_MAX_SNAPSHOTS", "3")
+
+	r, err := Resolve(execPath, workDir, nil)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	out, err := r.Annotated()
+	if err != nil {
+		t.Fatalf("Annotated() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"source: claude-files # default\n",
+		"  max_snapshots: 3 # env (CCD_BACKUP_MAX_SNAPSHOTS)\n",
+		"ignore_patterns: # default\n  - .DS_Store\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Annotated() missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "exclude") {
+		t.Errorf("Annotated() shows the deprecated exclude key:\n%s", out)
+	}
+}
+
+func TestResolved_MasksCredentials(t *testing.T) {
+	execPath, workDir := layerDirs(t)
+	repoConfig := filepath.Join(filepath.Dir(workDir), RepoConfigName)
+	writeLayer(t, repoConfig, `backup:
+  stores:
+    remote:
+      type: s3
+      bucket: backups
+      access_key: AKIDEXAMPLE
+      secret_key: wJalrXUtnFEMI
+    public:
+      type: s3
+      bucket: open
+`)
+
+	r, err := Resolve(execPath, workDir, nil)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if r.Backup.Stores["remote"].SecretKey != "wJalrXUtnFEMI" {
+		t.Error("Resolve() masked the config itself")
+	}
+
+	out, err := r.Annotated()
+	if err != nil {
+		t.Fatalf("Annotated() error = %v", err)
+	}
+	for _, secret := range []string{"AKIDEXAMPLE", "wJalrXUtnFEMI"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("Annotated() shows %s:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(out), "secret_key: '"+Masked+"'") || !strings.Contains(string(out), "stores: # repo ("+repoConfig+":2)") {
+		t.Errorf("Annotated() does not show the masked keys with their origin:\n%s", out)
+	}
+
+	for _, s := range r.Settings() {
+		if s.Key != "backup.stores" {
+			continue
+		}
+		stores := s.Value.(map[string]StoreConfig)
+		if stores["remote"].AccessKey != Masked || stores["remote"].SecretKey != Masked || stores["public"].SecretKey != "" {
+			t.Errorf("Settings() backup.stores = %+v", stores)
+		}
+		if s.Origin.Layer != LayerRepo {
+			t.Errorf("Settings() backup.stores origin = %v", s.Origin)
+		}
+	}
+}
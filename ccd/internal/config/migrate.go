@@ -0,0 +1,316 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version this ccd writes. Files
+// without a version key predate it and are version 1.
+const CurrentVersion = 2
+
+// Migrate upgrades a config file to CurrentVersion. Keys added since the
+// file was written are inserted with the comments and values of the
+// generated default config, as long as that keeps the settings in effect
+// (missing mappings are never added, for instance); deprecated keys are
+// folded into their replacements; and version is set. The user's values,
+// key order and comments are kept.
+//
+// It returns the migrated file and a description of each change. With no
+// changes, data is returned as is.
+func Migrate(data []byte) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("config is not a mapping")
+	}
+
+	defaultData := []byte(GenerateDefault())
+	var defaultDoc yaml.Node
+	if err := yaml.Unmarshal(defaultData, &defaultDoc); err != nil {
+		return nil, nil, err
+	}
+
+	// Blank lines are not part of the node tree; note where they were
+	spaced := spacedKeys(&doc, data)
+	for key := range spacedKeys(&defaultDoc, defaultData) {
+		spaced[key] = true
+	}
+
+	m := &migrator{}
+	if err := m.checkVersion(root); err != nil {
+		return nil, nil, err
+	}
+	m.addMissing(root, defaultDoc.Content[0], reflect.TypeOf(Config{}), reflect.ValueOf(*Default()), "")
+	m.replaceDeprecated(root, reflect.TypeOf(Config{}), "")
+	m.setVersion(root)
+
+	if len(m.changes) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	enc.Close()
+
+	migrated, err := restoreBlankLines(&doc, buf.Bytes(), spaced)
+	if err != nil {
+		return nil, nil, err
+	}
+	return restoreCommentSpacing(migrated, data, defaultData), m.changes, nil
+}
+
+type migrator struct {
+	changes []string
+}
+
+func (m *migrator) checkVersion(root *yaml.Node) error {
+	_, value := lookup(root, "version")
+	if value == nil {
+		return nil
+	}
+	version, err := strconv.Atoi(value.Value)
+	if err != nil {
+		return fmt.Errorf("version %q is not a number", value.Value)
+	}
+	if version > CurrentVersion {
+		return fmt.Errorf("config version %d is newer than this ccd supports (%d)", version, CurrentVersion)
+	}
+	return nil
+}
+
+// addMissing inserts the keys of def that node lacks, after the key that
+// precedes them in def. defaults holds the values in effect for missing
+// keys; a key is only added when def gives it the same value.
+func (m *migrator) addMissing(node, def *yaml.Node, t reflect.Type, defaults reflect.Value, path string) {
+	fields := yamlFields(t)
+	pos := 0
+
+	for i := 0; i+1 < len(def.Content); i += 2 {
+		defKey, defValue := def.Content[i], def.Content[i+1]
+		field, ok := fields[defKey.Value]
+		if !ok {
+			continue
+		}
+		keyPath := joinKey(path, defKey.Value)
+
+		if j := indexOf(node, defKey.Value); j >= 0 {
+			value := node.Content[j+1]
+			if field.Type.Kind() == reflect.Struct && value.Kind == yaml.MappingNode && defValue.Kind == yaml.MappingNode {
+				m.addMissing(value, defValue, field.Type, defaults.FieldByIndex(field.Index), keyPath)
+			}
+			pos = j + 2
+			continue
+		}
+
+		decoded := reflect.New(field.Type)
+		if err := defValue.Decode(decoded.Interface()); err != nil {
+			continue
+		}
+		if !sameValue(decoded.Elem(), defaults.FieldByIndex(field.Index)) {
+			continue
+		}
+
+		node.Content = append(node.Content[:pos], append([]*yaml.Node{defKey, defValue}, node.Content[pos:]...)...)
+		pos += 2
+		m.changes = append(m.changes, fmt.Sprintf("added %s", keyPath))
+	}
+}
+
+// replaceDeprecated moves the items of deprecated keys into the keys
+// named by their `deprecated` tag, as Decode does when loading.
+func (m *migrator) replaceDeprecated(node *yaml.Node, t reflect.Type, path string) {
+	fields := yamlFields(t)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := fields[key.Value]
+		if !ok {
+			continue
+		}
+		keyPath := joinKey(path, key.Value)
+
+		if field.Type.Kind() == reflect.Struct && value.Kind == yaml.MappingNode {
+			m.replaceDeprecated(value, field.Type, keyPath)
+			continue
+		}
+
+		replacement := field.Tag.Get("deprecated")
+		if replacement == "" {
+			continue
+		}
+
+		newKey, newValue := lookup(node, replacement)
+		if newKey == nil {
+			// Nothing to merge into; renaming keeps the position
+			key.Value = replacement
+			m.changes = append(m.changes, fmt.Sprintf("renamed %s to %s", keyPath, joinKey(path, replacement)))
+			continue
+		}
+		if value.Kind == yaml.SequenceNode && newValue.Kind == yaml.SequenceNode {
+			newValue.Content = append(newValue.Content, value.Content...)
+		}
+		if key.HeadComment != "" {
+			newKey.HeadComment = strings.TrimSpace(newKey.HeadComment + "\n" + key.HeadComment)
+		}
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+		i -= 2
+		m.changes = append(m.changes, fmt.Sprintf("moved %s into %s", keyPath, joinKey(path, replacement)))
+	}
+}
+
+func (m *migrator) setVersion(root *yaml.Node) {
+	version := strconv.Itoa(CurrentVersion)
+
+	key, value := lookup(root, "version")
+	if key == nil {
+		root.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+			{Kind: yaml.ScalarNode, Tag: "!!int", Value: version},
+		}, root.Content...)
+		m.changes = append(m.changes, fmt.Sprintf("set version to %s", version))
+		return
+	}
+	if value.Value != version {
+		m.changes = append(m.changes, fmt.Sprintf("updated version from %s to %s", value.Value, version))
+		value.Value = version
+		value.Tag = "!!int"
+	}
+}
+
+// spacedKeys returns the mapping keys of doc that follow a blank line in
+// data, counting from the start of their head comment.
+func spacedKeys(doc *yaml.Node, data []byte) map[*yaml.Node]bool {
+	lines := strings.Split(string(data), "\n")
+	spaced := make(map[*yaml.Node]bool)
+
+	walkKeys(doc, func(key *yaml.Node) {
+		start := key.Line - commentLines(key.HeadComment)
+		if start >= 2 && start-2 < len(lines) && strings.TrimSpace(lines[start-2]) == "" {
+			spaced[key] = true
+		}
+	})
+	return spaced
+}
+
+// restoreBlankLines puts a blank line back before each spaced key of doc
+// in its encoding, out.
+func restoreBlankLines(doc *yaml.Node, out []byte, spaced map[*yaml.Node]bool) ([]byte, error) {
+	var encoded yaml.Node
+	if err := yaml.Unmarshal(out, &encoded); err != nil {
+		return nil, err
+	}
+
+	// doc and its encoding have the same shape; pair their keys up
+	var keys, encodedKeys []*yaml.Node
+	walkKeys(doc, func(key *yaml.Node) { keys = append(keys, key) })
+	walkKeys(&encoded, func(key *yaml.Node) { encodedKeys = append(encodedKeys, key) })
+	if len(keys) != len(encodedKeys) {
+		return out, nil
+	}
+
+	lines := strings.Split(string(out), "\n")
+	var blankBefore []int
+	for i, key := range keys {
+		start := encodedKeys[i].Line - commentLines(encodedKeys[i].HeadComment)
+		if spaced[key] && start >= 2 && strings.TrimSpace(lines[start-2]) != "" {
+			blankBefore = append(blankBefore, start-1)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(blankBefore)))
+	for _, i := range blankBefore {
+		lines = append(lines[:i], append([]string{""}, lines[i:]...)...)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// restoreCommentSpacing puts a blank line back before the comment lines
+// of out that follow one in any of originals. This covers comments that
+// are not above a key, which yaml.v3 attaches to the key before them.
+func restoreCommentSpacing(out []byte, originals ...[]byte) []byte {
+	spaced := make(map[string]bool)
+	for _, original := range originals {
+		lines := strings.Split(string(original), "\n")
+		for i := 1; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(line, "#") && strings.TrimSpace(lines[i-1]) == "" {
+				spaced[line] = true
+			}
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if spaced[strings.TrimSpace(line)] && len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// walkKeys calls fn for the keys of every mapping below node, in order.
+func walkKeys(node *yaml.Node, fn func(key *yaml.Node)) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fn(node.Content[i])
+			walkKeys(node.Content[i+1], fn)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		walkKeys(child, fn)
+	}
+}
+
+func commentLines(comment string) int {
+	if comment == "" {
+		return 0
+	}
+	return strings.Count(comment, "\n") + 1
+}
+
+func indexOf(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func lookup(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if i := indexOf(mapping, key); i >= 0 {
+		return mapping.Content[i], mapping.Content[i+1]
+	}
+	return nil, nil
+}
+
+// sameValue is reflect.DeepEqual, with nil and empty maps and slices
+// considered equal.
+func sameValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Map, reflect.Slice:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
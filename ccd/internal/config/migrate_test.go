@@ -0,0 +1,127 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const legacyConfig = `# My ccd setup
+
+# Where my files live
+source: dotfiles
+target: ~/.claude # deployed here
+
+# Skip editor junk
+exclude:
+  - "*.bak"
+
+backup:
+  enabled: true
+  dir: ~/backups
+  max_snapshots: 3 # keep it small
+
+default_mode: merge
+confirm_deletes: false
+`
+
+func TestMigrate_LegacyConfig(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(legacyConfig))
+	if err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+	if len(changes) == 0 {
+		t.Fatal("Migrate() reported no changes")
+	}
+	out := string(migrated)
+
+	for _, want := range []string{
+		"# My ccd setup\n",
+		"# Where my files live\nsource: dotfiles\n",
+		"target: ~/.claude # deployed here\n",
+		"max_snapshots: 3 # keep it small\n",
+		"confirm_deletes: false\n",
+		"version: 2\n",
+		"# Skip editor junk\n",
+		`  - "*.bak"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("migrated config lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "exclude:") {
+		t.Errorf("migrated config still has exclude:\n%s", out)
+	}
+	if strings.Contains(out, "mappings:") {
+		t.Errorf("migrated config gained mappings, changing what is deployed:\n%s", out)
+	}
+
+	// User keys keep their order
+	if strings.Index(out, "source:") > strings.Index(out, "target:") ||
+		strings.Index(out, "target:") > strings.Index(out, "backup:") ||
+		strings.Index(out, "backup:") > strings.Index(out, "default_mode:") {
+		t.Errorf("migrated config reordered keys:\n%s", out)
+	}
+
+	// Blank lines between sections survive
+	if !strings.Contains(out, "\n\nbackup:\n") {
+		t.Errorf("migrated config lost blank lines:\n%s", out)
+	}
+
+	// The settings in effect are unchanged
+	before, after := Default(), Default()
+	if _, err := Decode("before.yaml", []byte(legacyConfig), before); err != nil {
+		t.Fatalf("Decode(legacy) failed: %v", err)
+	}
+	warnings, err := Decode("after.yaml", migrated, after)
+	if err != nil {
+		t.Fatalf("migrated config is invalid: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("migrated config has warnings: %v", warnings)
+	}
+	if strings.Join(before.IgnorePatterns, ",") != strings.Join(after.IgnorePatterns, ",") {
+		t.Errorf("IgnorePatterns = %v, want %v", after.IgnorePatterns, before.IgnorePatterns)
+	}
+	if before.Backup.Dir != after.Backup.Dir || before.Backup.Format != after.Backup.Format ||
+		before.Backup.Backend != after.Backup.Backend {
+		t.Errorf("Backup changed: %+v -> %+v", before.Backup, after.Backup)
+	}
+	if after.Backup.MaxSnapshots != 3 || after.ConfirmDeletes {
+		t.Errorf("user values were not kept: %+v", after)
+	}
+}
+
+func TestMigrate_MergesExcludeIntoIgnorePatterns(t *testing.T) {
+	migrated, _, err := Migrate([]byte("ignore_patterns:\n  - .git\nexclude:\n  - '*.bak'\n"))
+	if err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+
+	cfg := Default()
+	if _, err := Decode("config.yaml", migrated, cfg); err != nil {
+		t.Fatalf("migrated config is invalid: %v", err)
+	}
+	if got := strings.Join(cfg.IgnorePatterns, ","); got != ".git,*.bak" {
+		t.Errorf("IgnorePatterns = %s, want .git,*.bak", got)
+	}
+}
+
+func TestMigrate_UpToDate(t *testing.T) {
+	data := []byte(GenerateDefault())
+	migrated, changes, err := Migrate(data)
+	if err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Migrate() changes = %v, want none", changes)
+	}
+	if string(migrated) != string(data) {
+		t.Error("Migrate() rewrote an up-to-date config")
+	}
+}
+
+func TestMigrate_NewerVersion(t *testing.T) {
+	if _, _, err := Migrate([]byte("version: 99\n")); err == nil {
+		t.Error("expected an error for a config from a newer ccd")
+	}
+}
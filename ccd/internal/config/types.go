@@ -4,6 +4,6 @@ package config
 // Source is relative to the working directory.
 // Target is relative to the target directory.
 type Mapping struct {
-	Source string `yaml:"source"`
-	Target string `yaml:"target"`
+	Source string `yaml:"source" json:"source"`
+	Target string `yaml:"target" json:"target"`
 }
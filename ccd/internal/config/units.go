@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseAge parses a duration such as "36h", "30d" or "8w". Days and weeks
+// are accepted in addition to the units understood by time.ParseDuration.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 36h, 30d, 8w)", s)
+	}
+	return d, nil
+}
+
+// ParseSize parses a byte size such as "512KB", "500MB" or "2GB".
+// Units are binary (1KB = 1024 bytes); a bare number is taken as bytes.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if n, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value = strings.TrimSpace(n)
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500MB, 2GB)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"36h", 36 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAge(tt.input)
+		if err != nil {
+			t.Errorf("ParseAge(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAge(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseAge_Invalid(t *testing.T) {
+	for _, input := range []string{"", "d", "-3d", "soon"} {
+		if _, err := ParseAge(input); err == nil {
+			t.Errorf("ParseAge(%q) expected error", input)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"1024", 1024},
+		{"10B", 10},
+		{"512KB", 512 << 10},
+		{"500MB", 500 << 20},
+		{"1.5gb", 3 << 29},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if err != nil {
+			t.Errorf("ParseSize(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize_Invalid(t *testing.T) {
+	for _, input := range []string{"", "MB", "lots", "-1KB"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("ParseSize(%q) expected error", input)
+		}
+	}
+}
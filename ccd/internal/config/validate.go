@@ -0,0 +1,333 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Issue is a problem found in a config file, at the line and column of
+// the offending key or value.
+type Issue struct {
+	File    string
+	Line    int
+	Column  int
+	Key     string
+	Message string
+}
+
+func (i Issue) String() string {
+	pos := i.File
+	if i.Line > 0 {
+		pos += ":" + strconv.Itoa(i.Line)
+		if i.Column > 0 {
+			pos += ":" + strconv.Itoa(i.Column)
+		}
+	}
+	if i.Key != "" {
+		return fmt.Sprintf("%s: %s: %s", pos, i.Key, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", pos, i.Message)
+}
+
+// ValidationError lists the problems that make a config file invalid.
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = issue.String()
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// yamlLine finds the line number in yaml.v3 syntax errors and in the
+// entries of a *yaml.TypeError.
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// Decode strictly decodes the config file at path over cfg. Unknown keys,
+// values of the wrong type, values outside a field's `enum` tag, values
+// that do not parse as the field's `unit` tag and a compression level out
+// of range for the backup format make it fail with a *ValidationError.
+// Keys with a `deprecated` tag are decoded, and returned as warnings
+// naming their replacement.
+func Decode(path string, data []byte, cfg *Config) ([]Issue, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		issue := Issue{File: path, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = strings.TrimPrefix(err.Error(), m[0])
+		}
+		return nil, &ValidationError{Issues: []Issue{issue}}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	v := &validator{file: path}
+	v.check(doc.Content[0], reflect.TypeOf(*cfg), "")
+	v.checkCompressionLevel(doc.Content[0], cfg.Backup.Format)
+	if len(v.errors) > 0 {
+		return v.warnings, &ValidationError{Issues: v.errors}
+	}
+
+	if err := doc.Decode(cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			v.typeErrors(doc.Content[0], typeErr)
+			return v.warnings, &ValidationError{Issues: v.errors}
+		}
+		return v.warnings, err
+	}
+	if cfg.Version > CurrentVersion {
+		key, _ := lookup(doc.Content[0], "version")
+		v.report(&v.errors, key, "version", "%d is newer than this ccd supports (%d); upgrade ccd", cfg.Version, CurrentVersion)
+		return v.warnings, &ValidationError{Issues: v.errors}
+	}
+	cfg.IgnorePatterns = append(cfg.IgnorePatterns, cfg.Exclude...)
+	cfg.Exclude = nil
+
+	return v.warnings, nil
+}
+
+type validator struct {
+	file     string
+	errors   []Issue
+	warnings []Issue
+}
+
+func (v *validator) report(issues *[]Issue, node *yaml.Node, key, format string, args ...any) {
+	*issues = append(*issues, Issue{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// typeErrors reports each unmarshal error, such as a duplicate key, at
+// the key or list item on its line.
+func (v *validator) typeErrors(root *yaml.Node, err *yaml.TypeError) {
+	for _, msg := range err.Errors {
+		issue := Issue{File: v.file, Message: msg}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = strings.TrimPrefix(msg, m[0])
+			if node, path := nodeAt(root, "", issue.Line); node != nil {
+				issue.Column, issue.Key = node.Column, path
+			}
+		}
+		v.errors = append(v.errors, issue)
+	}
+}
+
+// nodeAt finds the first key, or list item, on line below node.
+func nodeAt(node *yaml.Node, path string, line int) (*yaml.Node, string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinKey(path, key.Value)
+			if key.Line == line {
+				return key, keyPath
+			}
+			if found, foundPath := nodeAt(value, keyPath, line); found != nil {
+				return found, foundPath
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if item.Line == line && item.Kind == yaml.ScalarNode {
+				return item, itemPath
+			}
+			if found, foundPath := nodeAt(item, itemPath, line); found != nil {
+				return found, foundPath
+			}
+		}
+	}
+	return nil, ""
+}
+
+// check validates node against the Go type it decodes into.
+func (v *validator) check(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.report(&v.errors, node, path, "expected a mapping")
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinKey(path, key.Value)
+
+			field, ok := fields[key.Value]
+			if !ok {
+				v.report(&v.errors, key, keyPath, "unknown key")
+				continue
+			}
+			if replacement := field.Tag.Get("deprecated"); replacement != "" {
+				v.report(&v.warnings, key, keyPath, "deprecated, use %s instead", replacement)
+			}
+
+			v.checkField(field, value, keyPath)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.report(&v.errors, node, path, "expected a list")
+			return
+		}
+		for i, item := range node.Content {
+			v.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.report(&v.errors, node, path, "expected a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.check(node.Content[i+1], t.Elem(), joinKey(path, node.Content[i].Value))
+		}
+
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.report(&v.errors, node, path, "expected %s", typeName(t))
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			v.report(&v.errors, node, path, "expected %s, got %q", typeName(t), node.Value)
+		}
+	}
+}
+
+// checkField validates the value of a struct field, including its
+// `enum` and `unit` tags.
+func (v *validator) checkField(field reflect.StructField, value *yaml.Node, path string) {
+	v.check(value, field.Type, path)
+
+	if value.Kind != yaml.ScalarNode || value.Tag == "!!null" {
+		return
+	}
+	if enum := field.Tag.Get("enum"); enum != "" {
+		if allowed := strings.Split(enum, ","); !contains(allowed, value.Value) {
+			v.report(&v.errors, value, path, "%q is not one of %s", value.Value, strings.Join(allowed, ", "))
+		}
+	}
+	if err := parseUnit(field.Tag.Get("unit"), value.Value); err != nil {
+		v.report(&v.errors, value, path, "%v", err)
+	}
+}
+
+// parseUnit checks a value against a `unit` tag: "age" for ParseAge and
+// "size" for ParseSize. An empty value leaves the setting unset.
+func parseUnit(unit, value string) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch unit {
+	case "age":
+		_, err = ParseAge(value)
+	case "size":
+		_, err = ParseSize(value)
+	}
+	return err
+}
+
+// checkCompressionLevel validates backup.compression_level against the
+// backup format set next to it, or else format, which earlier layers set.
+func (v *validator) checkCompressionLevel(root *yaml.Node, format string) {
+	_, backup := lookup(root, "backup")
+	if backup == nil || backup.Kind != yaml.MappingNode {
+		return
+	}
+	_, level := lookup(backup, "compression_level")
+	if level == nil {
+		return
+	}
+	n, err := strconv.Atoi(level.Value)
+	if err != nil {
+		// Reported by check
+		return
+	}
+	if _, f := lookup(backup, "format"); f != nil && f.Kind == yaml.ScalarNode {
+		format = f.Value
+	}
+	if err := compressionLevel(format, n); err != nil {
+		v.report(&v.errors, level, "backup.compression_level", "%v", err)
+	}
+}
+
+// compressionLevel reports a level out of range for the backup format.
+func compressionLevel(format string, level int) error {
+	if format == "" {
+		format = "zip"
+	}
+	if max := MaxCompressionLevel(format); level < 0 || level > max {
+		return fmt.Errorf("%d is out of range for %s (1-%d, or 0 for the default)", level, format, max)
+	}
+	return nil
+}
+
+// yamlFields maps the yaml keys of a struct type to its fields.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "a whole number"
+	default:
+		return "a string"
+	}
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeIssues(t *testing.T, content string) []Issue {
+	t.Helper()
+	_, err := Decode("config.yaml", []byte(content), Default())
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Decode() error = %v, want a *ValidationError", err)
+	}
+	return invalid.Issues
+}
+
+func TestDecode_UnknownKeys(t *testing.T) {
+	issues := decodeIssues(t, `source: claude-files
+ignore_pattern:
+  - .git
+mappings:
+  - source: CLAUDE.md
+    target: CLAUDE.md
+    mode: sync
+backup:
+  max_snapshot: 5
+  stores:
+    remote:
+      type: s3
+      acl: private
+`)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		"config.yaml:2:1: ignore_pattern: unknown key",
+		"config.yaml:7:5: mappings[0].mode: unknown key",
+		"config.yaml:9:3: backup.max_snapshot: unknown key",
+		"config.yaml:13:7: backup.stores.remote.acl: unknown key",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDecode_TypesAndEnums(t *testing.T) {
+	issues := decodeIssues(t, `default_mode: mirror
+confirm_deletes: sometimes
+ignore_patterns: .git
+backup:
+  max_snapshots: five
+  backend: svn
+  format: rar
+  stores:
+    remote:
+      type: ftp
+`)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		`config.yaml:1:15: default_mode: "mirror" is not one of merge, sync`,
+		`config.yaml:2:18: confirm_deletes: expected true or false, got "sometimes"`,
+		`config.yaml:3:18: ignore_patterns: expected a list`,
+		`config.yaml:5:18: backup.max_snapshots: expected a whole number, got "five"`,
+		`config.yaml:6:12: backup.backend: "svn" is not one of archive, git`,
+		`config.yaml:7:11: backup.format: "rar" is not one of zip, tar.gz, tar.zst`,
+		`config.yaml:10:13: backup.stores.remote.type: "ftp" is not one of local, s3`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDecode_UnitsAndCompressionLevel(t *testing.T) {
+	issues := decodeIssues(t, `backup:
+  max_age: 30 days
+  max_total_size: lots
+  format: tar.gz
+  compression_level: 12
+`)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		`config.yaml:2:12: backup.max_age: invalid age "30 days" (use e.g. 36h, 30d, 8w)`,
+		`config.yaml:3:19: backup.max_total_size: invalid size "lots" (use e.g. 500MB, 2GB)`,
+		`config.yaml:5:22: backup.compression_level: 12 is out of range for tar.gz (1-9, or 0 for the default)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The format may come from an earlier layer
+	cfg := Default()
+	cfg.Backup.Format = "tar.zst"
+	if _, err := Decode("config.yaml", []byte("backup:\n  compression_level: 19\n  max_age: 30d\n  max_total_size: 2GB\n"), cfg); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+}
+
+func TestDecode_SyntaxError(t *testing.T) {
+	issues := decodeIssues(t, "source: claude-files\ntarget: [\n")
+	if len(issues) != 1 || issues[0].Line == 0 {
+		t.Fatalf("issues = %+v, want one issue with a line", issues)
+	}
+	if !strings.HasPrefix(issues[0].String(), "config.yaml:") {
+		t.Errorf("issue %q does not cite the file", issues[0])
+	}
+}
+
+func TestDecode_UnmarshalErrors(t *testing.T) {
+	issues := decodeIssues(t, `source: claude-files
+backup:
+  max_snapshots: 5
+  dir: ~/backups
+  max_snapshots: 10
+mappings:
+  - source: CLAUDE.md
+    target: CLAUDE.md
+    source: AGENTS.md
+`)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		`config.yaml:5:3: backup.max_snapshots: mapping key "max_snapshots" already defined at line 3`,
+		`config.yaml:9:5: mappings[0].source: mapping key "source" already defined at line 7`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDecode_LegacyExclude(t *testing.T) {
+	cfg := &Config{}
+	warnings, err := Decode("config.yaml", []byte("exclude:\n  - .git\nignore_patterns:\n  - '*.tmp'\n"), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(warnings) != 1 || warnings[0].String() != "config.yaml:1:1: exclude: deprecated, use ignore_patterns instead" {
+		t.Errorf("warnings = %+v", warnings)
+	}
+	if want := []string{"*.tmp", ".git"}; !reflect.DeepEqual(cfg.IgnorePatterns, want) {
+		t.Errorf("IgnorePatterns = %v, want %v", cfg.IgnorePatterns, want)
+	}
+	if cfg.Exclude != nil {
+		t.Errorf("Exclude = %v, want nil", cfg.Exclude)
+	}
+}
+
+func TestDecode_Generated(t *testing.T) {
+	warnings, err := Decode("config.yaml", []byte(GenerateDefault()), Default())
+	if err != nil {
+		t.Fatalf("generated config is invalid: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("generated config has warnings: %+v", warnings)
+	}
+}
+
+func TestLoad_RejectsUnknownKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("max_snapshot: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := Load(filepath.Join(tempDir, "ccd"))
+	if err == nil {
+		t.Fatal("expected an error for an unknown key")
+	}
+	if !strings.Contains(err.Error(), configPath+":1:1: max_snapshot: unknown key") {
+		t.Errorf("error %q does not cite the key's position", err)
+	}
+}
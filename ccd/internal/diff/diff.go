@@ -0,0 +1,332 @@
+// Package diff computes line-based differences between two texts and
+// renders them in unified diff format.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+// Kind identifies how a line differs between the old and new text.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Insert
+	Delete
+)
+
+// Line is a single line of an edit script. OldLine and NewLine are 1-based
+// positions in the respective texts, or 0 when the line is absent there.
+type Line struct {
+	Kind    Kind
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Hunk is a contiguous group of changes plus surrounding context.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// splitLines splits text into lines that keep their newline, so that a
+// last line without one differs from the same line with one.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the shortest edit script that turns a into b, using Myers'
+// O(ND) algorithm. Where a change replaces lines, deletions come first.
+func Lines(a, b []string) []Line {
+	// Lines shared at both ends are never part of the shortest script
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var script []Line
+	for i := 0; i < prefix; i++ {
+		script = append(script, Line{Kind: Equal, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+	for _, l := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if l.OldLine > 0 {
+			l.OldLine += prefix
+		}
+		if l.NewLine > 0 {
+			l.NewLine += prefix
+		}
+		script = append(script, l)
+	}
+	for i := suffix; i > 0; i-- {
+		script = append(script, Line{Kind: Equal, Text: a[len(a)-i], OldLine: len(a) - i + 1, NewLine: len(b) - i + 1})
+	}
+	return script
+}
+
+// myers finds the furthest reaching path for each number of edits d and
+// then walks the recorded frontiers back from the end.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k = x - y
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		// Only diagonals -d..d can be reached with d edits
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var reversed []Line
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// trace[d] holds the frontier before step d, indexed from -d
+		prev := func(k int) int { return trace[d][k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = prev(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Kind: Equal, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			reversed = append(reversed, Line{Kind: Insert, Text: b[y-1], NewLine: y})
+		} else {
+			reversed = append(reversed, Line{Kind: Delete, Text: a[x-1], OldLine: x})
+		}
+		x, y = prevX, prevY
+	}
+
+	script := make([]Line, len(reversed))
+	for i, l := range reversed {
+		script[len(reversed)-1-i] = l
+	}
+	return script
+}
+
+// Hunks groups an edit script into hunks with the given amount of context.
+// Changes separated by at most 2*context unchanged lines share a hunk.
+func Hunks(script []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	i := 0
+	for i < len(script) {
+		// Find the next change
+		for i < len(script) && script[i].Kind == Equal {
+			i++
+		}
+		if i == len(script) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are close enough to merge
+		end := i
+		for end < len(script) {
+			if script[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].Kind == Equal {
+				run++
+			}
+			if run == len(script) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, newHunk(script[start:end]))
+		i = end
+	}
+
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.Kind != Insert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldLine
+			}
+			h.OldLines++
+		}
+		if l.Kind != Delete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+// Header returns the "@@ -a,b +c,d @@" line for the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range points at the line before the change
+		if start > 0 {
+			start--
+		}
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Unified renders the difference between oldText and newText as a unified
+// diff, marking a last line without a newline as diff does. It returns an
+// empty string when the texts are identical.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	hunks := Hunks(Lines(splitLines(oldText), splitLines(newText)), context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- " + oldName + "\n")
+	sb.WriteString("+++ " + newName + "\n")
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, l := range h.Lines {
+			text, terminated := strings.CutSuffix(l.Text, "\n")
+			sb.WriteString(prefix(l.Kind) + text + "\n")
+			if !terminated {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func prefix(kind Kind) string {
+	switch kind {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Files renders the difference between two files as a unified diff, or as
+// a single line when either of them is binary. It returns an empty string
+// when the contents are identical.
+func Files(oldName, newName string, oldData, newData []byte, context int) string {
+	if bytes.Equal(oldData, newData) {
+		return ""
+	}
+	if isBinary(oldData) || isBinary(newData) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	return Unified(oldName, newName, string(oldData), string(newData), context)
+}
+
+// Colorize colors the lines of a unified diff for the terminal. Nothing
+// is added when colors are disabled.
+func Colorize(unified string) string {
+	lines := strings.SplitAfter(unified, "\n")
+	for i, line := range lines {
+		text := strings.TrimSuffix(line, "\n")
+		if text == "" {
+			continue
+		}
+
+		var color string
+		switch {
+		case strings.HasPrefix(text, "--- "), strings.HasPrefix(text, "+++ "), strings.HasPrefix(text, "Binary files "):
+			color = output.Blue
+		case strings.HasPrefix(text, "@@"):
+			color = output.Cyan
+		case strings.HasPrefix(text, "+"):
+			color = output.Green
+		case strings.HasPrefix(text, "-"):
+			color = output.Red
+		default:
+			continue
+		}
+		lines[i] = output.Colorize(color, text) + line[len(text):]
+	}
+	return strings.Join(lines, "")
+}
+
+// isBinary reports whether data looks like binary content rather than text.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified_IdenticalTexts(t *testing.T) {
+	if got := Unified("a", "b", "same\ntext\n", "same\ntext\n", DefaultContext); got != "" {
+		t.Errorf("expected empty diff, got:\n%s", got)
+	}
+}
+
+func TestUnified_InsertedLineKeepsAlignment(t *testing.T) {
+	oldText := "one\ntwo\nthree\nfour\n"
+	newText := "one\ninserted\ntwo\nthree\nfour\n"
+
+	got := Unified("old", "new", oldText, newText, DefaultContext)
+	want := `--- old
++++ new
+@@ -1,4 +1,5 @@
+ one
++inserted
+ two
+ three
+ four
+`
+	if got != want {
+		t.Errorf("unexpected diff:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 20; i++ {
+		line := string(rune('a' + i))
+		oldLines = append(oldLines, line)
+		newLines = append(newLines, line)
+	}
+	newLines[1] = "B"
+	newLines[18] = "S"
+
+	got := Unified("old", "new", strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"), 2)
+
+	if strings.Count(got, "@@ -") != 2 {
+		t.Fatalf("expected 2 hunks, got:\n%s", got)
+	}
+	if !strings.Contains(got, "@@ -1,4 +1,4 @@") {
+		t.Errorf("expected first hunk header, got:\n%s", got)
+	}
+	if !strings.Contains(got, "@@ -17,4 +17,4 @@") {
+		t.Errorf("expected second hunk header, got:\n%s", got)
+	}
+}
+
+func TestUnified_CreatedFile(t *testing.T) {
+	got := Unified("/dev/null", "new", "", "line\n", DefaultContext)
+	if !strings.Contains(got, "@@ -0,0 +1 @@\n+line\n") {
+		t.Errorf("unexpected diff for created file:\n%s", got)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if isBinary([]byte("plain text\n")) {
+		t.Error("expected text to not be binary")
+	}
+	if !isBinary([]byte{'P', 'K', 0, 1}) {
+		t.Error("expected NUL bytes to be detected as binary")
+	}
+}
+
+func TestUnified_MissingNewlineAtEnd(t *testing.T) {
+	got := Unified("old", "new", "one\ntwo\n", "one\ntwo", DefaultContext)
+	want := `--- old
++++ new
+@@ -1,2 +1,2 @@
+ one
+-two
++two
+\ No newline at end of file
+`
+	if got != want {
+		t.Errorf("unexpected diff:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = Unified("old", "new", "one\ntwo", "one\n2", DefaultContext)
+	if !strings.Contains(got, "-two\n\\ No newline at end of file\n+2\n\\ No newline at end of file\n") {
+		t.Errorf("expected both sides marked, got:\n%s", got)
+	}
+}
+
+func TestLines_ShortestScript(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+
+	script := Lines(a, b)
+
+	var oldText, newText []string
+	edits := 0
+	for _, l := range script {
+		if l.Kind != Insert {
+			oldText = append(oldText, l.Text)
+		}
+		if l.Kind != Delete {
+			newText = append(newText, l.Text)
+		}
+		if l.Kind != Equal {
+			edits++
+		}
+	}
+	if strings.Join(oldText, " ") != strings.Join(a, " ") || strings.Join(newText, " ") != strings.Join(b, " ") {
+		t.Fatalf("script does not reproduce both texts: %+v", script)
+	}
+	// The example from Myers' paper needs 5 edits
+	if edits != 5 {
+		t.Errorf("expected 5 edits, got %d", edits)
+	}
+}
+
+func TestUnified_ReplacedLineDeletesFirst(t *testing.T) {
+	got := Unified("old", "new", "one\ntwo\nthree\n", "one\n2\nthree\n", DefaultContext)
+	if !strings.Contains(got, " one\n-two\n+2\n three\n") {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestFiles_Binary(t *testing.T) {
+	got := Files("a/logo.png", "b/logo.png", []byte{0x89, 'P', 'N', 'G', 0}, []byte{0x89, 'P', 'N', 'G', 0, 1}, DefaultContext)
+	if got != "Binary files a/logo.png and b/logo.png differ\n" {
+		t.Errorf("unexpected output for binary files: %q", got)
+	}
+	if got := Files("a", "b", []byte{0}, []byte{0}, DefaultContext); got != "" {
+		t.Errorf("expected identical binary files to produce no output, got %q", got)
+	}
+}
@@ -0,0 +1,199 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SchemaVersion is the version of the machine-readable output. It only
+// changes when fields are removed or change meaning; fields and event
+// types may be added within a version.
+const SchemaVersion = 1
+
+// Output formats selected with --output.
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// Event types of the machine-readable output.
+const (
+	EventPlan      = "plan"      // []FileChange
+	EventSummary   = "summary"   // Summary
+	EventBackup    = "backup"    // SnapshotInfo of a snapshot just taken
+	EventPrune     = "prune"     // PruneResult
+	EventSnapshots = "snapshots" // []SnapshotInfo, newest first
+	EventRestore   = "restore"   // RestoreResult
+	EventStatus    = "status"    // []MappingStatusInfo
+	EventError     = "error"     // ErrorInfo
+	EventChecks    = "checks"    // []CheckResult
+	EventConfig    = "config"    // []ConfigSetting
+	EventVersion   = "version"   // VersionInfo
+)
+
+// SnapshotInfo describes a backup snapshot.
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size"`
+	Target    string    `json:"target,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Label     string    `json:"label,omitempty"`
+	Mode      string    `json:"mode,omitempty"`
+	Encrypted bool      `json:"encrypted"`
+	Commit    string    `json:"commit,omitempty"`
+	Store     string    `json:"store,omitempty"`
+}
+
+// PruneResult lists the snapshots a prune removed, or would remove in a
+// dry run. Kept is only reported by ccd backup prune.
+type PruneResult struct {
+	DryRun  bool     `json:"dry_run"`
+	Removed []string `json:"removed"`
+	Kept    []string `json:"kept,omitempty"`
+}
+
+// RestoreResult describes a rollback or extraction. Backup is the
+// pre-rollback snapshot; Into is set when extracting elsewhere.
+type RestoreResult struct {
+	Snapshot SnapshotInfo  `json:"snapshot"`
+	Backup   *SnapshotInfo `json:"backup,omitempty"`
+	Paths    []string      `json:"paths,omitempty"`
+	Into     string        `json:"into,omitempty"`
+	Files    int           `json:"files,omitempty"`
+}
+
+// MappingStatusInfo is the state of one mapping: "in_sync", "pending" or
+// "drifted".
+type MappingStatusInfo struct {
+	Mapping string   `json:"mapping"`
+	Target  string   `json:"target"`
+	State   string   `json:"state"`
+	Pending int      `json:"pending"`
+	Drifted []string `json:"drifted"`
+}
+
+// CheckResult is the outcome of one ccd doctor check: "pass", "warn" or
+// "fail", with a hint on how to fix anything but a pass.
+type CheckResult struct {
+	Group   string `json:"group"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// ConfigSetting is the effective value of a config key and the layer it
+// came from. Source is the file and line, variable or flag that set it.
+type ConfigSetting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Layer  string `json:"layer"`
+	Source string `json:"source,omitempty"`
+}
+
+// VersionInfo identifies the ccd build.
+type VersionInfo struct {
+	Version string `json:"version"`
+}
+
+// ErrorInfo reports the error a command failed with.
+type ErrorInfo struct {
+	Message string `json:"message"`
+}
+
+var (
+	format  = FormatText
+	command string
+	machine io.Writer
+	events  = map[string]any{}
+)
+
+// Stdout receives the human-readable output and prompts: stdout, or
+// stderr once a machine-readable format is selected.
+var Stdout io.Writer = os.Stdout
+
+// SetFormat selects the output format. With json or ndjson, the
+// machine-readable output takes over stdout; human-readable messages and
+// prompts move to stderr, without colors.
+func SetFormat(f string) error {
+	switch f {
+	case "", FormatText:
+		return nil
+	case FormatJSON, FormatNDJSON:
+	default:
+		return fmt.Errorf("invalid output format %q (expected text, json or ndjson)", f)
+	}
+
+	format = f
+	machine = os.Stdout
+	Stdout = os.Stderr
+	DisableColors()
+	return nil
+}
+
+// Machine reports whether a machine-readable format is selected.
+func Machine() bool {
+	return format != FormatText
+}
+
+// RawStdout hands stdout to a command that writes raw content to it, such
+// as a file of a snapshot. Nothing machine-readable follows the content.
+func RawStdout() {
+	if machine != nil {
+		machine = io.Discard
+	}
+}
+
+// SetCommand records the command being run, e.g. "ccd backup prune".
+func SetCommand(path string) {
+	command = path
+}
+
+// Emit reports a result. With ndjson it is written as a line right away;
+// with json it is collected for Flush, and a later event of the same type
+// replaces it. Text output ignores events.
+func Emit(event string, data any) {
+	switch format {
+	case FormatNDJSON:
+		writeJSON(map[string]any{
+			"schema_version": SchemaVersion,
+			"type":           event,
+			"data":           data,
+		})
+	case FormatJSON:
+		events[event] = data
+	}
+}
+
+// Flush writes the json document holding the collected events, keyed by
+// event type.
+func Flush() {
+	if format != FormatJSON {
+		return
+	}
+
+	document := map[string]any{
+		"schema_version": SchemaVersion,
+		"command":        command,
+	}
+	for event, data := range events {
+		document[event] = data
+	}
+	writeJSON(document)
+}
+
+func writeJSON(v any) {
+	enc := json.NewEncoder(machine)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		enc.Encode(map[string]any{
+			"schema_version": SchemaVersion,
+			"type":           EventError,
+			"data":           ErrorInfo{Message: err.Error()},
+		})
+	}
+}
@@ -5,9 +5,9 @@ import (
 )
 
 type Summary struct {
-	Created int
-	Updated int
-	Deleted int
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
 }
 
 func (s *Summary) Add(operation string) {
@@ -26,28 +26,28 @@ func (s *Summary) HasChanges() bool {
 }
 
 func (s *Summary) Print() {
-	fmt.Println()
-	fmt.Println(Colorize(Blue, "Summary:"))
+	fmt.Fprintln(Stdout)
+	fmt.Fprintln(Stdout, Colorize(Blue, "Summary:"))
 
 	if !s.HasChanges() {
-		fmt.Println("  No changes")
+		fmt.Fprintln(Stdout, "  No changes")
 		return
 	}
 
 	if s.Created > 0 {
-		fmt.Printf("  %s: %d %s\n",
+		fmt.Fprintf(Stdout, "  %s: %d %s\n",
 			Colorize(Green, "Created"),
 			s.Created,
 			pluralize("file", s.Created))
 	}
 	if s.Updated > 0 {
-		fmt.Printf("  %s: %d %s\n",
+		fmt.Fprintf(Stdout, "  %s: %d %s\n",
 			Colorize(Yellow, "Updated"),
 			s.Updated,
 			pluralize("file", s.Updated))
 	}
 	if s.Deleted > 0 {
-		fmt.Printf("  %s: %d %s\n",
+		fmt.Fprintf(Stdout, "  %s: %d %s\n",
 			Colorize(Red, "Deleted"),
 			s.Deleted,
 			pluralize("file", s.Deleted))
@@ -68,39 +68,39 @@ func PrintMode(isDryRun, isSync bool) {
 	}
 
 	if isDryRun {
-		fmt.Printf("%s DRY RUN: Analyzing changes (%s mode)\n\n",
+		fmt.Fprintf(Stdout, "%s DRY RUN: Analyzing changes (%s mode)\n\n",
 			Colorize(Yellow, "🔍"),
 			mode)
 	} else {
-		fmt.Printf("%s Deploying (%s mode)\n\n",
+		fmt.Fprintf(Stdout, "%s Deploying (%s mode)\n\n",
 			Colorize(Blue, "🚀"),
 			mode)
 	}
 }
 
 func PrintPaths(source, target string) {
-	fmt.Printf("Source: %s\n", Colorize(Blue, source))
-	fmt.Printf("Target: %s\n\n", Colorize(Blue, target))
+	fmt.Fprintf(Stdout, "Source: %s\n", Colorize(Blue, source))
+	fmt.Fprintf(Stdout, "Target: %s\n\n", Colorize(Blue, target))
 }
 
 func PrintSuccess(isDryRun bool) {
 	if isDryRun {
-		fmt.Printf("\n%s Dry run completed. No changes made.\n",
+		fmt.Fprintf(Stdout, "\n%s Dry run completed. No changes made.\n",
 			Colorize(Yellow, "✅"))
 	} else {
-		fmt.Printf("\n%s Deployment completed successfully!\n",
+		fmt.Fprintf(Stdout, "\n%s Deployment completed successfully!\n",
 			Colorize(Green, "✅"))
 	}
 }
 
 func PrintError(msg string) {
-	fmt.Printf("%s %s\n", Colorize(Red, "❌"), msg)
+	fmt.Fprintf(Stdout, "%s %s\n", Colorize(Red, "❌"), msg)
 }
 
 func PrintWarning(msg string) {
-	fmt.Printf("%s %s\n", Colorize(Yellow, "⚠️"), msg)
+	fmt.Fprintf(Stdout, "%s %s\n", Colorize(Yellow, "⚠️"), msg)
 }
 
 func PrintInfo(msg string) {
-	fmt.Printf("%s %s\n", Colorize(Blue, "ℹ️"), msg)
+	fmt.Fprintf(Stdout, "%s %s\n", Colorize(Blue, "ℹ️"), msg)
 }
@@ -9,11 +9,11 @@ import (
 )
 
 type FileChange struct {
-	Path      string
-	Operation string // "create", "update", "delete"
-	Size      int64
-	ModTime   time.Time
-	IsDir     bool
+	Path      string    `json:"path"`
+	Operation string    `json:"operation"` // "create", "update", "delete"
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	IsDir     bool      `json:"is_dir"`
 }
 
 type TreeNode struct {
@@ -153,5 +153,5 @@ func formatAge(t time.Time) string {
 }
 
 func PrintTreeHeader(targetPath string) {
-	fmt.Println(Colorize(Cyan, targetPath+"/"))
+	fmt.Fprintln(Stdout, Colorize(Cyan, targetPath+"/"))
 }
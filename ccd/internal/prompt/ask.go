@@ -0,0 +1,118 @@
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// Asker asks a series of questions. Answers are read from one reader, so
+// none are lost to buffering when they are piped in.
+type Asker struct {
+	in  *bufio.Reader
+	out io.Writer
+	// tty is the descriptor of the terminal in reads from, or -1
+	tty int
+}
+
+func NewAsker(in io.Reader, out io.Writer) *Asker {
+	a := &Asker{in: bufio.NewReader(in), out: out, tty: -1}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		a.tty = int(f.Fd())
+	}
+	return a
+}
+
+// Stdin asks on stdin. Every prompt of this package reads its answer
+// from it, so answers piped in one after the other each reach their
+// prompt.
+var Stdin = NewAsker(os.Stdin, stdout{})
+
+// stdout writes to output.Stdout as it is when written to, which moves
+// to stderr under --output json.
+type stdout struct{}
+
+func (stdout) Write(p []byte) (int, error) {
+	return output.Stdout.Write(p)
+}
+
+// answer prints question and returns the trimmed reply; "" means the
+// default was accepted.
+func (a *Asker) answer(question string) (string, error) {
+	fmt.Fprint(a.out, question)
+	reply, err := a.in.ReadString('\n')
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+// YesNo asks a yes or no question; an empty reply picks def.
+func (a *Asker) YesNo(message string, def bool) (bool, error) {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+	for {
+		reply, err := a.answer(fmt.Sprintf("%s %s ", message, choices))
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(reply) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(a.out, "  Please answer y or n")
+	}
+}
+
+// Text asks for a value; an empty reply picks def.
+func (a *Asker) Text(message, def string) (string, error) {
+	reply, err := a.answer(fmt.Sprintf("%s [%s]: ", message, def))
+	if err != nil || reply == "" {
+		return def, err
+	}
+	return reply, nil
+}
+
+// Number asks for a whole number of at least min; an empty reply picks
+// def.
+func (a *Asker) Number(message string, def, min int) (int, error) {
+	for {
+		reply, err := a.answer(fmt.Sprintf("%s [%d]: ", message, def))
+		if err != nil || reply == "" {
+			return def, err
+		}
+		if n, err := strconv.Atoi(reply); err == nil && n >= min {
+			return n, nil
+		}
+		fmt.Fprintf(a.out, "  Please enter a whole number of at least %d\n", min)
+	}
+}
+
+// Choose asks for one of choices; an empty reply picks def.
+func (a *Asker) Choose(message string, choices []string, def string) (string, error) {
+	for {
+		reply, err := a.answer(fmt.Sprintf("%s (%s) [%s]: ", message, strings.Join(choices, "/"), def))
+		if err != nil || reply == "" {
+			return def, err
+		}
+		for _, c := range choices {
+			if strings.EqualFold(reply, c) {
+				return c, nil
+			}
+		}
+		fmt.Fprintf(a.out, "  Please answer one of: %s\n", strings.Join(choices, ", "))
+	}
+}
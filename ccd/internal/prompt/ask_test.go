@@ -0,0 +1,56 @@
+package prompt
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// withStdin makes the package prompts read input for the rest of the test.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	saved := Stdin
+	Stdin = NewAsker(strings.NewReader(input), io.Discard)
+	t.Cleanup(func() { Stdin = saved })
+}
+
+func TestPrompts_SharePipedInput(t *testing.T) {
+	// Passphrase and confirmation as `ccd rollback` asks for them
+	withStdin(t, " secret \ny\n")
+
+	passphrase, err := Password("Backup passphrase:")
+	if err != nil {
+		t.Fatalf("Password() error = %v", err)
+	}
+	if passphrase != " secret " {
+		t.Errorf("Password() = %q, want %q", passphrase, " secret ")
+	}
+	if !Confirm("Continue?", false) {
+		t.Error("Confirm() = false after the passphrase, want the piped y")
+	}
+}
+
+func TestSelectChanges_AfterPassword(t *testing.T) {
+	withStdin(t, "secret\nn\ny\n")
+
+	if _, err := Password("Backup passphrase:"); err != nil {
+		t.Fatalf("Password() error = %v", err)
+	}
+	changes := []output.FileChange{
+		{Path: "a/one.md", Operation: "create"},
+		{Path: "a/two.md", Operation: "update"},
+	}
+	saved := output.Stdout
+	output.Stdout = io.Discard
+	defer func() { output.Stdout = saved }()
+
+	selected, err := SelectChanges(changes, func(output.FileChange) {})
+	if err != nil {
+		t.Fatalf("SelectChanges() error = %v", err)
+	}
+	if selected["a/one.md"] || !selected["a/two.md"] {
+		t.Errorf("SelectChanges() = %v, want only a/two.md", selected)
+	}
+}
@@ -1,9 +1,7 @@
 package prompt
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/pt/ccd/internal/output"
@@ -14,15 +12,12 @@ func Confirm(message string, skipConfirm bool) bool {
 		return true
 	}
 
-	fmt.Printf("%s [y/N] ", message)
-
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
+	response, err := Stdin.answer(fmt.Sprintf("%s [y/N] ", message))
 	if err != nil {
 		return false
 	}
 
-	response = strings.ToLower(strings.TrimSpace(response))
+	response = strings.ToLower(response)
 	return response == "y" || response == "yes"
 }
 
@@ -35,7 +30,7 @@ func ConfirmDeletes(files []output.FileChange, skipConfirm bool) bool {
 		return true
 	}
 
-	fmt.Printf("\n%s Sync mode will delete:\n", output.Colorize(output.Yellow, "⚠️"))
+	fmt.Fprintf(output.Stdout, "\n%s Sync mode will delete:\n", output.Colorize(output.Yellow, "⚠️"))
 
 	var totalSize int64
 	fileCount := 0
@@ -43,17 +38,17 @@ func ConfirmDeletes(files []output.FileChange, skipConfirm bool) bool {
 	for _, f := range files {
 		if !f.IsDir {
 			age := formatAge(f.ModTime)
-			fmt.Printf("  - %s (%s", f.Path, formatSize(f.Size))
+			fmt.Fprintf(output.Stdout, "  - %s (%s", f.Path, formatSize(f.Size))
 			if age != "" {
-				fmt.Printf(", modified %s", age)
+				fmt.Fprintf(output.Stdout, ", modified %s", age)
 			}
-			fmt.Println(")")
+			fmt.Fprintln(output.Stdout, ")")
 			totalSize += f.Size
 			fileCount++
 		}
 	}
 
-	fmt.Printf("  Total: %d %s, %s\n\n",
+	fmt.Fprintf(output.Stdout, "  Total: %d %s, %s\n\n",
 		fileCount,
 		pluralize("file", fileCount),
 		formatSize(totalSize))
@@ -0,0 +1,35 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Password reads a line from Stdin. On a terminal it is read without
+// echoing; piped input is read as is.
+func Password(message string) (string, error) {
+	return Stdin.Password(message)
+}
+
+// Password reads a line, without echoing it on a terminal. Unlike the
+// other answers it is not trimmed beyond the line ending.
+func (a *Asker) Password(message string) (string, error) {
+	fmt.Fprintf(a.out, "%s ", message)
+
+	if a.tty >= 0 {
+		password, err := term.ReadPassword(a.tty)
+		fmt.Fprintln(a.out)
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return string(password), nil
+	}
+
+	response, err := a.in.ReadString('\n')
+	if err != nil && response == "" {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimRight(response, "\r\n"), nil
+}
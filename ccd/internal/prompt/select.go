@@ -0,0 +1,82 @@
+package prompt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// SelectChanges steps through changes, grouped by directory, asking which
+// to apply. showDiff prints the content changes of a file on request. It
+// returns the accepted paths.
+func SelectChanges(changes []output.FileChange, showDiff func(output.FileChange)) (map[string]bool, error) {
+	selected := make(map[string]bool)
+
+	// decided holds the choice made for the rest of a directory
+	decided := make(map[string]bool)
+	dir := "\x00"
+
+	for i := 0; i < len(changes); i++ {
+		c := changes[i]
+		if d := filepath.Dir(c.Path); d != dir {
+			dir = d
+			fmt.Fprintf(output.Stdout, "\n%s\n", output.Colorize(output.Blue, dir+string(filepath.Separator)))
+		}
+
+		if accept, ok := decided[dir]; ok {
+			selected[c.Path] = accept
+			fmt.Fprintf(output.Stdout, "  %s %s\n", describeChange(c), choiceLabel(accept))
+			continue
+		}
+
+		response, err := Stdin.answer(fmt.Sprintf("  %s  [y]es [n]o [d]iff [a]ll [s]kip all in %s [q]uit? ", describeChange(c), dir))
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(response) {
+		case "y", "yes":
+			selected[c.Path] = true
+		case "n", "no":
+		case "d", "diff":
+			showDiff(c)
+			i--
+		case "a", "all":
+			decided[dir] = true
+			i--
+		case "s", "skip":
+			decided[dir] = false
+			i--
+		case "q", "quit":
+			// Skip everything not decided yet
+			return selected, nil
+		default:
+			fmt.Fprintln(output.Stdout, "  y: apply this change, n: skip it, d: show its diff,")
+			fmt.Fprintln(output.Stdout, "  a: apply the rest of this directory, s: skip the rest of this directory,")
+			fmt.Fprintln(output.Stdout, "  q: skip all remaining changes")
+			i--
+		}
+	}
+
+	return selected, nil
+}
+
+func describeChange(c output.FileChange) string {
+	switch c.Operation {
+	case "create":
+		return output.Colorize(output.Green, "[+] "+filepath.Base(c.Path))
+	case "delete":
+		return output.Colorize(output.Red, "[-] "+filepath.Base(c.Path))
+	default:
+		return output.Colorize(output.Yellow, "[~] "+filepath.Base(c.Path))
+	}
+}
+
+func choiceLabel(accept bool) string {
+	if accept {
+		return "(apply)"
+	}
+	return "(skip)"
+}
@@ -25,7 +25,7 @@ func CalculateDiff(sourceDir, targetDir string, ignorePatterns []string, syncMod
 
 		baseName := filepath.Base(path)
 
-		if shouldIgnore(baseName, ignorePatterns) {
+		if ShouldIgnore(baseName, ignorePatterns) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -59,7 +59,7 @@ func CalculateDiff(sourceDir, targetDir string, ignorePatterns []string, syncMod
 			}
 
 			baseName := filepath.Base(path)
-			if shouldIgnore(baseName, ignorePatterns) {
+			if ShouldIgnore(baseName, ignorePatterns) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
@@ -116,7 +116,7 @@ func CalculateDiff(sourceDir, targetDir string, ignorePatterns []string, syncMod
 
 			if _, existsInSource := sourceFiles[sourceRelPath]; !existsInSource {
 				baseName := filepath.Base(relPath)
-				if !shouldIgnore(baseName, ignorePatterns) {
+				if !ShouldIgnore(baseName, ignorePatterns) {
 					changes = append(changes, output.FileChange{
 						Path:      relPath,
 						Operation: "delete",
@@ -132,7 +132,9 @@ func CalculateDiff(sourceDir, targetDir string, ignorePatterns []string, syncMod
 	return changes, nil
 }
 
-func shouldIgnore(name string, patterns []string) bool {
+// ShouldIgnore reports whether a file or directory name matches one of
+// the ignore patterns.
+func ShouldIgnore(name string, patterns []string) bool {
 	for _, pattern := range patterns {
 		if matched, _ := filepath.Match(pattern, name); matched {
 			return true
@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// Selectable returns the changes to offer for selection, ordered by path:
+// files, and directories without changes below them. Other directory
+// changes follow from the selected files; see Subset.
+func Selectable(changes []output.FileChange) []output.FileChange {
+	var selectable []output.FileChange
+	for _, c := range changes {
+		if !c.IsDir || len(descendants(changes, c.Path)) == 0 {
+			selectable = append(selectable, c)
+		}
+	}
+	sort.Slice(selectable, func(i, j int) bool { return selectable[i].Path < selectable[j].Path })
+	return selectable
+}
+
+// Subset returns the selected changes among those offered by Selectable,
+// plus the directory changes they depend on: a directory is created when
+// anything below it is, and deleted only when everything below it is.
+func Subset(changes []output.FileChange, selected map[string]bool) []output.FileChange {
+	var subset []output.FileChange
+	for _, c := range changes {
+		below := descendants(changes, c.Path)
+		if !c.IsDir || len(below) == 0 {
+			if selected[c.Path] {
+				subset = append(subset, c)
+			}
+			continue
+		}
+
+		someSelected, allSelected := false, true
+		for _, d := range below {
+			if d.IsDir && len(descendants(changes, d.Path)) > 0 {
+				continue
+			}
+			if selected[d.Path] {
+				someSelected = true
+			} else {
+				allSelected = false
+			}
+		}
+		if (c.Operation == "delete" && allSelected) || (c.Operation != "delete" && someSelected) {
+			subset = append(subset, c)
+		}
+	}
+	return subset
+}
+
+// Roots returns the paths of the changes that are not below another
+// change's path, i.e. the smallest set of paths covering all changes.
+func Roots(changes []output.FileChange) []string {
+	paths := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		paths[filepath.Clean(c.Path)] = true
+	}
+
+	var roots []string
+	for path := range paths {
+		covered := false
+		for parent := filepath.Dir(path); parent != "." && parent != string(filepath.Separator); parent = filepath.Dir(parent) {
+			if paths[parent] {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			roots = append(roots, path)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+func descendants(changes []output.FileChange, dir string) []output.FileChange {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	var below []output.FileChange
+	for _, c := range changes {
+		if strings.HasPrefix(filepath.Clean(c.Path), prefix) {
+			below = append(below, c)
+		}
+	}
+	return below
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+func changePaths(changes []output.FileChange) []string {
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+func TestSubset_IncludesDirectoriesOfSelectedFiles(t *testing.T) {
+	changes := []output.FileChange{
+		{Path: "CLAUDE.md", Operation: "update"},
+		{Path: "skills", Operation: "create", IsDir: true},
+		{Path: filepath.Join("skills", "new"), Operation: "create", IsDir: true},
+		{Path: filepath.Join("skills", "new", "SKILL.md"), Operation: "create"},
+		{Path: filepath.Join("skills", "new", "NOTES.md"), Operation: "create"},
+		{Path: "old", Operation: "delete", IsDir: true},
+		{Path: filepath.Join("old", "a.md"), Operation: "delete"},
+		{Path: filepath.Join("old", "b.md"), Operation: "delete"},
+	}
+
+	wantSelectable := []string{
+		"CLAUDE.md",
+		filepath.Join("old", "a.md"),
+		filepath.Join("old", "b.md"),
+		filepath.Join("skills", "new", "NOTES.md"),
+		filepath.Join("skills", "new", "SKILL.md"),
+	}
+	if got := changePaths(Selectable(changes)); !reflect.DeepEqual(got, wantSelectable) {
+		t.Errorf("Selectable = %v, want %v", got, wantSelectable)
+	}
+
+	subset := Subset(changes, map[string]bool{
+		filepath.Join("skills", "new", "SKILL.md"): true,
+		filepath.Join("old", "a.md"):               true,
+	})
+	want := []string{
+		"skills",
+		filepath.Join("skills", "new"),
+		filepath.Join("skills", "new", "SKILL.md"),
+		filepath.Join("old", "a.md"),
+	}
+	if got := changePaths(subset); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subset = %v, want %v (the partly kept directory must not be deleted)", got, want)
+	}
+
+	if got := Roots(subset); !reflect.DeepEqual(got, []string{filepath.Join("old", "a.md"), "skills"}) {
+		t.Errorf("Roots = %v", got)
+	}
+}
+
+func TestSync_AppliesOnlySelectedChanges(t *testing.T) {
+	sourceDir := t.TempDir()
+	targetDir := t.TempDir()
+
+	createFile(t, sourceDir, "CLAUDE.md", "new claude")
+	createFile(t, sourceDir, "skills/new/SKILL.md", "new skill")
+	createFile(t, targetDir, "CLAUDE.md", "old claude")
+
+	result, err := Sync(SyncOptions{
+		SourceDir: sourceDir,
+		TargetDir: targetDir,
+		Select:    map[string]bool{filepath.Join("skills", "new", "SKILL.md"): true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Summary.Updated != 0 || result.Summary.Created != 3 {
+		t.Errorf("unexpected summary: %+v", result.Summary)
+	}
+	for path, want := range map[string]string{"CLAUDE.md": "old claude", "skills/new/SKILL.md": "new skill"} {
+		data, err := os.ReadFile(filepath.Join(targetDir, path))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: expected %q, got %q (%v)", path, want, data, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pt/ccd/internal/output"
+)
+
+// MappingStatus summarizes what a deploy would change below one mapping.
+type MappingStatus struct {
+	// Mapping is "source -> target", or "." without mappings.
+	Mapping string
+	// Target is the mapping's target path relative to the target root.
+	Target string
+	// Pending counts the changes a deploy would apply.
+	Pending int
+	// Drifted lists the target files edited after their source, which a
+	// deploy would overwrite.
+	Drifted []string
+}
+
+// InSync reports whether a deploy would leave the mapping unchanged.
+func (s MappingStatus) InSync() bool {
+	return s.Pending == 0 && len(s.Drifted) == 0
+}
+
+// Status computes the same changes as a dry-run Sync and groups them by
+// mapping, in config order.
+func Status(opts SyncOptions) ([]MappingStatus, error) {
+	var mappingSet *MappingSet
+	if len(opts.Mappings) > 0 {
+		var err error
+		mappingSet, err = ResolveMappings(opts.SourceDir, opts.TargetDir, opts.Mappings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve mappings: %w", err)
+		}
+	}
+
+	changes, err := CalculateDiff(opts.SourceDir, opts.TargetDir, opts.IgnorePatterns, opts.SyncMode, mappingSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate diff: %w", err)
+	}
+
+	statuses := []MappingStatus{{Mapping: ".", Target: "."}}
+	if mappingSet != nil {
+		statuses = make([]MappingStatus, len(mappingSet.Items))
+		for i, m := range mappingSet.Items {
+			statuses[i] = MappingStatus{Mapping: formatResolvedMapping(m), Target: m.RelTarget}
+		}
+	}
+
+	for _, c := range changes {
+		i := 0
+		if mappingSet != nil {
+			i = mappingIndex(mappingSet, c.Path)
+			if i < 0 {
+				continue
+			}
+		}
+
+		if c.Operation == "update" && isDrifted(c, opts.TargetDir) {
+			statuses[i].Drifted = append(statuses[i].Drifted, c.Path)
+			continue
+		}
+		statuses[i].Pending++
+	}
+
+	return statuses, nil
+}
+
+// mappingIndex returns the index of the mapping covering targetRelPath,
+// or -1.
+func mappingIndex(ms *MappingSet, targetRelPath string) int {
+	normalized := filepath.Clean(targetRelPath)
+	for i, m := range ms.Items {
+		mappingTarget := filepath.Clean(m.RelTarget)
+		if normalized == mappingTarget ||
+			(m.IsDir && strings.HasPrefix(normalized, mappingTarget+string(filepath.Separator))) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isDrifted reports whether the target file of an update was modified
+// after its source, i.e. edited in place since it was deployed.
+func isDrifted(c output.FileChange, targetDir string) bool {
+	info, err := os.Stat(filepath.Join(targetDir, c.Path))
+	if err != nil {
+		return false
+	}
+	return info.ModTime().After(c.ModTime)
+}
@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pt/ccd/internal/config"
+)
+
+func TestStatus_GroupsChangesByMapping(t *testing.T) {
+	sourceDir := t.TempDir()
+	targetDir := t.TempDir()
+
+	createFile(t, sourceDir, "CLAUDE.md", "claude")
+	createFile(t, sourceDir, "skills/tdd/SKILL.md", "tdd")
+	createFile(t, sourceDir, "skills/qa/SKILL.md", "qa")
+	createFile(t, sourceDir, "commands/review.md", "review")
+
+	opts := SyncOptions{
+		SourceDir: sourceDir,
+		TargetDir: targetDir,
+		Mappings: []config.Mapping{
+			{Source: "CLAUDE.md", Target: "CLAUDE.md"},
+			{Source: "skills/", Target: "skills/"},
+			{Source: "commands/", Target: "commands/"},
+		},
+	}
+	if _, err := Sync(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A new source file, and a target file edited after its deploy
+	createFile(t, sourceDir, "skills/qa/NOTES.md", "notes")
+	createFile(t, targetDir, "commands/review.md", "edited in place")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(targetDir, "commands/review.md"), later, later); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	statuses, err := Status(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 statuses, got %d", len(statuses))
+	}
+
+	if !statuses[0].InSync() {
+		t.Errorf("expected CLAUDE.md in sync, got %+v", statuses[0])
+	}
+	if statuses[1].Pending != 1 || len(statuses[1].Drifted) != 0 {
+		t.Errorf("expected 1 pending change in skills, got %+v", statuses[1])
+	}
+	if statuses[2].Pending != 0 || len(statuses[2].Drifted) != 1 || statuses[2].Drifted[0] != filepath.Join("commands", "review.md") {
+		t.Errorf("expected commands/review.md to have drifted, got %+v", statuses[2])
+	}
+}
+
+func TestStatus_WithoutMappings(t *testing.T) {
+	sourceDir := t.TempDir()
+	targetDir := t.TempDir()
+
+	createFile(t, sourceDir, "CLAUDE.md", "claude")
+
+	statuses, err := Status(SyncOptions{SourceDir: sourceDir, TargetDir: targetDir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Target != "." || statuses[0].Pending != 1 {
+		t.Errorf("expected 1 pending change for the whole target, got %+v", statuses)
+	}
+}
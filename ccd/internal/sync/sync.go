@@ -16,6 +16,9 @@ type SyncOptions struct {
 	IgnorePatterns []string
 	SyncMode       bool
 	DryRun         bool
+	// Select limits the changes to the selected paths and the directory
+	// changes they depend on; nil selects every change.
+	Select map[string]bool
 }
 
 type SyncResult struct {
@@ -43,6 +46,9 @@ func Sync(opts SyncOptions) (*SyncResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate diff: %w", err)
 	}
+	if opts.Select != nil {
+		changes = Subset(changes, opts.Select)
+	}
 
 	result := &SyncResult{
 		Changes: changes,
@@ -0,0 +1,57 @@
+// Package vcs reports the version control state of the source directory.
+package vcs
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Status describes the git checkout a directory belongs to.
+type Status struct {
+	Commit string
+	Branch string
+	Dirty  bool
+}
+
+// Describe returns the git status of dir. It fails when git is not
+// installed or dir is not inside a work tree.
+func Describe(dir string) (*Status, error) {
+	commit, err := Git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := Git(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := Git(dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		Commit: commit,
+		Branch: branch,
+		Dirty:  changes != "",
+	}, nil
+}
+
+// Git runs a git command in dir and returns its trimmed standard output.
+func Git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_ATTRIB | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotify watches every directory holding watched files. Directories
+// created below a watched one are watched as they appear.
+type inotify struct {
+	root  string
+	paths []string
+	file  *os.File
+	fd    int
+	dirs  map[int]string // watch descriptor -> root-relative directory
+	out   chan string
+	done  chan struct{}
+}
+
+func newInotify(root string, paths []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &inotify{
+		root:  root,
+		paths: paths,
+		// A non-blocking descriptor lets close interrupt a pending read
+		file: os.NewFile(uintptr(fd), "inotify"),
+		fd:   fd,
+		dirs: make(map[int]string),
+		out:  make(chan string),
+		done: make(chan struct{}),
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(filepath.Join(root, p))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			err = w.addTree(p)
+		} else {
+			// Watch the parent so files replaced on save stay watched
+			err = w.addDir(filepath.Dir(p))
+		}
+		if err != nil {
+			w.file.Close()
+			return nil, err
+		}
+	}
+
+	go w.run()
+	return w, nil
+}
+
+func (w *inotify) events() <-chan string {
+	return w.out
+}
+
+func (w *inotify) close() {
+	close(w.done)
+	w.file.Close()
+}
+
+func (w *inotify) addDir(relDir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, filepath.Join(w.root, relDir), inotifyMask)
+	if err != nil {
+		return err
+	}
+	w.dirs[wd] = filepath.Clean(relDir)
+	return nil
+}
+
+// addTree watches relDir and every directory below it.
+func (w *inotify) addTree(relDir string) error {
+	var err error
+	walk(w.root, []string{relDir}, func(relPath string, info os.FileInfo) {
+		if info.IsDir() && err == nil {
+			err = w.addDir(relPath)
+		}
+	})
+	return err
+}
+
+func (w *inotify) run() {
+	defer close(w.out)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			offset = nameEnd
+
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+				continue
+			}
+			dir, ok := w.dirs[int(event.Wd)]
+			if !ok || name == "" {
+				continue
+			}
+			relPath := filepath.Join(dir, name)
+			if !covered(w.paths, relPath) {
+				continue
+			}
+
+			changed := []string{relPath}
+			if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				// Files may have been written before the watch was added
+				w.addTree(relPath)
+				changed = nil
+				walk(w.root, []string{relPath}, func(p string, info os.FileInfo) {
+					if !info.IsDir() {
+						changed = append(changed, p)
+					}
+				})
+			}
+			for _, p := range changed {
+				if !w.send(p) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *inotify) send(relPath string) bool {
+	select {
+	case w.out <- relPath:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+func newInotify(root string, paths []string) (notifier, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
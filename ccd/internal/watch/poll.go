@@ -0,0 +1,88 @@
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// poller compares the watched files against their previous state at a
+// fixed interval.
+type poller struct {
+	root   string
+	paths  []string
+	out    chan string
+	done   chan struct{}
+	ticker *time.Ticker
+}
+
+func newPoller(root string, paths []string, interval time.Duration) (notifier, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	p := &poller{
+		root:   root,
+		paths:  paths,
+		out:    make(chan string),
+		done:   make(chan struct{}),
+		ticker: time.NewTicker(interval),
+	}
+	go p.run(p.scan())
+	return p, nil
+}
+
+func (p *poller) events() <-chan string {
+	return p.out
+}
+
+func (p *poller) close() {
+	p.ticker.Stop()
+	close(p.done)
+}
+
+func (p *poller) scan() map[string]fileState {
+	state := make(map[string]fileState)
+	walk(p.root, p.paths, func(relPath string, info os.FileInfo) {
+		if !info.IsDir() {
+			state[relPath] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	})
+	return state
+}
+
+func (p *poller) run(previous map[string]fileState) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.ticker.C:
+		}
+
+		current := p.scan()
+		var changed []string
+		for path, s := range current {
+			if old, ok := previous[path]; !ok || old != s {
+				changed = append(changed, path)
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		previous = current
+
+		for _, path := range changed {
+			select {
+			case p.out <- path:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
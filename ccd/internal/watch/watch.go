@@ -0,0 +1,129 @@
+// Package watch reports changes to files below a directory, using
+// inotify on Linux and polling elsewhere.
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default timings of Watch.
+const (
+	DefaultInterval = time.Second
+	DefaultDebounce = 300 * time.Millisecond
+)
+
+// Options describes what to watch.
+type Options struct {
+	// Root is the directory changes are reported relative to.
+	Root string
+	// Paths are the files and directories below Root to watch; empty
+	// watches all of Root.
+	Paths []string
+	// Interval is how often files are checked when polling.
+	Interval time.Duration
+	// Debounce is how long to wait for a burst of changes to end before
+	// reporting it.
+	Debounce time.Duration
+	// Poll disables inotify.
+	Poll bool
+}
+
+// notifier delivers the root-relative paths of changed files.
+type notifier interface {
+	events() <-chan string
+	close()
+}
+
+// Watch calls fn with the sorted, root-relative paths changed in each
+// burst of changes until ctx is done. Created, modified and removed files
+// are all reported. Once watching, started is called with the name of
+// the mechanism in use: "inotify" or "polling".
+func Watch(ctx context.Context, opts Options, started func(mechanism string), fn func(changed []string)) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if len(opts.Paths) == 0 {
+		opts.Paths = []string{"."}
+	}
+
+	var n notifier
+	mechanism := "inotify"
+	if !opts.Poll {
+		n, _ = newInotify(opts.Root, opts.Paths)
+	}
+	if n == nil {
+		var err error
+		if n, err = newPoller(opts.Root, opts.Paths, opts.Interval); err != nil {
+			return err
+		}
+		mechanism = "polling"
+	}
+	defer n.close()
+
+	if started != nil {
+		started(mechanism)
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(opts.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case path, ok := <-n.events():
+			if !ok {
+				return nil
+			}
+			pending[path] = true
+			timer.Reset(opts.Debounce)
+
+		case <-timer.C:
+			changed := make([]string, 0, len(pending))
+			for path := range pending {
+				changed = append(changed, path)
+			}
+			sort.Strings(changed)
+			pending = make(map[string]bool)
+			fn(changed)
+		}
+	}
+}
+
+// covered reports whether relPath is one of the watched paths or lies
+// below one of them.
+func covered(paths []string, relPath string) bool {
+	relPath = filepath.Clean(relPath)
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if p == "." || relPath == p || strings.HasPrefix(relPath, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every file and directory at or below the watched
+// paths. Missing paths are skipped.
+func walk(root string, paths []string, fn func(relPath string, info os.FileInfo)) {
+	for _, p := range paths {
+		filepath.Walk(filepath.Join(root, p), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			relPath, _ := filepath.Rel(root, path)
+			fn(relPath, info)
+			return nil
+		})
+	}
+}
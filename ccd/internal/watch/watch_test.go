@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// watchBursts starts Watch and returns the bursts it reports.
+func watchBursts(t *testing.T, opts Options) <-chan []string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	bursts := make(chan []string, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		err := Watch(ctx, opts, func(string) { close(started) }, func(changed []string) {
+			bursts <- changed
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not start")
+	}
+	return bursts
+}
+
+func nextBurst(t *testing.T, bursts <-chan []string) []string {
+	t.Helper()
+	select {
+	case changed := <-bursts:
+		return changed
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes reported")
+		return nil
+	}
+}
+
+func testWatch(t *testing.T, poll bool) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "skills", "tdd", "SKILL.md"), "v1")
+	writeFile(t, filepath.Join(root, "CLAUDE.md"), "v1")
+	writeFile(t, filepath.Join(root, "unmapped.md"), "v1")
+
+	bursts := watchBursts(t, Options{
+		Root:     root,
+		Paths:    []string{"skills", "CLAUDE.md"},
+		Interval: 20 * time.Millisecond,
+		Debounce: 100 * time.Millisecond,
+		Poll:     poll,
+	})
+
+	// A burst of writes is reported once
+	writeFile(t, filepath.Join(root, "skills", "tdd", "SKILL.md"), "v2")
+	writeFile(t, filepath.Join(root, "skills", "new", "SKILL.md"), "v1")
+	writeFile(t, filepath.Join(root, "CLAUDE.md"), "v22")
+	writeFile(t, filepath.Join(root, "unmapped.md"), "v2")
+
+	want := []string{"CLAUDE.md", filepath.Join("skills", "new", "SKILL.md"), filepath.Join("skills", "tdd", "SKILL.md")}
+	if got := nextBurst(t, bursts); !reflect.DeepEqual(got, want) {
+		t.Errorf("changed = %v, want %v", got, want)
+	}
+
+	if err := os.Remove(filepath.Join(root, "skills", "tdd", "SKILL.md")); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{filepath.Join("skills", "tdd", "SKILL.md")}
+	if got := nextBurst(t, bursts); !reflect.DeepEqual(got, want) {
+		t.Errorf("changed = %v, want %v", got, want)
+	}
+}
+
+func TestWatch_Poll(t *testing.T) {
+	testWatch(t, true)
+}
+
+func TestWatch_Inotify(t *testing.T) {
+	n, err := newInotify(t.TempDir(), nil)
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	n.close()
+	testWatch(t, false)
+}
+
+func TestCovered(t *testing.T) {
+	paths := []string{"skills", "CLAUDE.md"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"skills", true},
+		{filepath.Join("skills", "tdd", "SKILL.md"), true},
+		{"CLAUDE.md", true},
+		{"skills-old", false},
+		{"other.md", false},
+	}
+	for _, tt := range tests {
+		if got := covered(paths, tt.path); got != tt.want {
+			t.Errorf("covered(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if !covered([]string{"."}, "anything") {
+		t.Error("covered(\".\") should cover everything")
+	}
+}